@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Checkpoint - журнал посчитанных результатов SingleHash/MultiHash в append-only файле,
+// по одной JSON-строке на результат. Перезапущенный пайплайн с тем же файлом не считает
+// такие входы заново, а сразу выдаёт сохранённый результат.
+// Файл привязан к Config (в том числе Salt) и DataSignerSalt: при их смене нужен новый файл.
+type Checkpoint struct {
+	mu      sync.Mutex
+	file    *os.File
+	results map[checkpointKey]string
+}
+
+type checkpointKey struct {
+	stage string
+	input string
+}
+
+type checkpointRecord struct {
+	Stage  string `json:"stage"`
+	Input  string `json:"input"`
+	Result string `json:"result"`
+}
+
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{file: file, results: make(map[checkpointKey]string)}
+	if err := c.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// load читает журнал и отрезает недописанную последнюю строку,
+// которая остаётся, если процесс убили посреди записи
+func (c *Checkpoint) load() error {
+	data, err := io.ReadAll(c.file)
+	if err != nil {
+		return err
+	}
+
+	valid := bytes.LastIndexByte(data, '\n') + 1
+	for n, line := range bytes.Split(data[:valid], []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var rec checkpointRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+		c.results[checkpointKey{rec.Stage, rec.Input}] = rec.Result
+	}
+
+	if valid < len(data) {
+		if err := c.file.Truncate(int64(valid)); err != nil {
+			return err
+		}
+	}
+	_, err = c.file.Seek(int64(valid), io.SeekStart)
+	return err
+}
+
+func (c *Checkpoint) Get(stage, input string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.results[checkpointKey{stage, input}]
+	return result, ok
+}
+
+// Put дописывает результат одной записью write, чтобы после kill
+// в файле оставались только целые строки (кроме, возможно, последней)
+func (c *Checkpoint) Put(stage, input, result string) error {
+	line, err := json.Marshal(checkpointRecord{Stage: stage, Input: input, Result: result})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(line); err != nil {
+		return err
+	}
+	c.results[checkpointKey{stage, input}] = result
+	return nil
+}
+
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.results)
+}
+
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
+
+// checkpointed возвращает сохранённый результат стадии или считает его через compute и сохраняет
+func (s *Signer) checkpointed(stage, data string, compute func(string) (string, error)) (string, error) {
+	if s.Checkpoint == nil {
+		return compute(data)
+	}
+	if result, ok := s.Checkpoint.Get(stage, data); ok {
+		s.logf("%s %s restored from checkpoint\n", data, stage)
+		return result, nil
+	}
+
+	result, err := compute(data)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Checkpoint.Put(stage, data, result); err != nil {
+		s.logf("%s %s checkpoint error: %v\n", data, stage, err)
+	}
+	return result, nil
+}
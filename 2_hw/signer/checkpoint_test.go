@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckpointReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	c, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("SingleHash", "0", "4108050209~502633748")
+	c.Put("MultiHash", "4108050209~502633748", "2956866606")
+	c.Close()
+
+	// недописанная строка, как после kill посреди записи
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"stage":"SingleHash","inp`)
+	f.Close()
+
+	c, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, ok := c.Get("SingleHash", "0"); !ok || result != "4108050209~502633748" {
+		t.Errorf("got %q, %v", result, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 records, got %d", c.Len())
+	}
+	c.Put("SingleHash", "1", "2212294583~709660146")
+	c.Close()
+
+	data, _ := os.ReadFile(path)
+	if lines := bytes.Count(data, []byte{'\n'}); lines != 3 || !bytes.HasSuffix(data, []byte("}\n")) {
+		t.Errorf("broken tail was not truncated:\n%s", data)
+	}
+}
+
+func countingSigners(t *testing.T, delay time.Duration) *uint32 {
+	fastSigners(t, delay)
+	crc32Signer := DataSignerCrc32
+	var calls uint32
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(&calls, 1)
+		return crc32Signer(data)
+	}
+	return &calls
+}
+
+const checkpointInputs = 20
+
+// TestCheckpointResume запускает пайплайн отдельным процессом, убивает его посреди работы
+// и дозапускает с тем же файлом: посчитанное до kill повторно не считается
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperCheckpointProcess$")
+	cmd.Env = append(os.Environ(), "SIGNER_CHECKPOINT="+path)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		data, _ := os.ReadFile(path)
+		if bytes.Count(data, []byte{'\n'}) >= 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			t.Fatal("helper process wrote no checkpoints")
+		}
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	calls := countingSigners(t, 0)
+	var expected string
+	ExecutePipeline(intSource(checkpointInputs), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&expected))
+
+	c, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var singles, multis uint32
+	for key := range c.results {
+		if key.stage == "SingleHash" {
+			singles++
+		} else {
+			multis++
+		}
+	}
+	if singles == 0 || singles == checkpointInputs {
+		t.Fatalf("helper must be killed midway, got %d of %d single hashes", singles, checkpointInputs)
+	}
+
+	s := newSigner(DefaultConfig)
+	s.Checkpoint = c
+	atomic.StoreUint32(calls, 0)
+	var result string
+	ExecutePipeline(intSource(checkpointInputs), job(s.SingleHash), job(s.MultiHash), job(CombineResults), collectResult(&result))
+
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	expectedCalls := 2*(checkpointInputs-singles) + 6*(checkpointInputs-multis)
+	if got := atomic.LoadUint32(calls); got != expectedCalls {
+		t.Errorf("expected %d crc32 calls after resume, got %d", expectedCalls, got)
+	}
+	if c.Len() != 2*checkpointInputs {
+		t.Errorf("expected all %d results in checkpoint, got %d", 2*checkpointInputs, c.Len())
+	}
+}
+
+func TestHelperCheckpointProcess(t *testing.T) {
+	path := os.Getenv("SIGNER_CHECKPOINT")
+	if path == "" {
+		t.Skip("helper process for TestCheckpointResume")
+	}
+	fastSigners(t, 50*time.Millisecond)
+
+	c, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSigner(DefaultConfig)
+	s.Checkpoint = c
+	ExecutePipeline(intSource(checkpointInputs), job(s.SingleHash), job(s.MultiHash), job(CombineResults))
+}
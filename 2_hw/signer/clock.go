@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - источник времени для DataSigner* и Md5Resource. В тестах его можно
+// заменить на FakeClock, чтобы секундные задержки проходили в виртуальном времени.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	// Timer - After, который можно отменить: stop убирает несработавший таймер
+	Timer(d time.Duration) (c <-chan time.Time, stop func() bool)
+}
+
+var SignerClock Clock = RealClock{}
+
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                         { return time.Now() }
+func (RealClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (RealClock) Timer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// FakeClock - виртуальные часы: время стоит, пока его не сдвинут Advance/AdvanceNext,
+// и тогда просыпаются все, чей срок наступил. Тест сам решает, когда сдвигать время:
+// BlockUntil дожидается нужного числа спящих.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *FakeClock) Timer(d time.Duration) (<-chan time.Time, func() bool) {
+	ch := c.After(d)
+	return ch, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, t := range c.timers {
+			if t.ch == ch {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+// AdvanceNext сдвигает время до ближайшего таймера; false - таймеров нет
+func (c *FakeClock) AdvanceNext() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.timers) == 0 {
+		return false
+	}
+	next := c.timers[0].at
+	for _, t := range c.timers[1:] {
+		if t.at.Before(next) {
+			next = t.at
+		}
+	}
+	c.advanceTo(next)
+	return true
+}
+
+func (c *FakeClock) advanceTo(now time.Time) {
+	c.now = now
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- now
+	}
+	c.timers = pending
+}
+
+// Waiters - сколько таймеров ещё не сработало
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil ждёт (в реальном времени), пока не наберётся n спящих
+func (c *FakeClock) BlockUntil(n int) {
+	for c.Waiters() < n {
+		time.Sleep(100 * time.Microsecond)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// реализации из common.go: TestSigner подменяет их насовсем
+var (
+	commonDataSignerCrc32 = DataSignerCrc32
+	commonDataSignerMd5   = DataSignerMd5
+	commonOverheatLock    = OverheatLock
+	commonOverheatUnlock  = OverheatUnlock
+)
+
+// fakeClock подставляет виртуальные часы и DataSigner* из common.go
+func fakeClock(t *testing.T) *FakeClock {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	crc32Signer, md5Signer, lock, unlock, signerClock := DataSignerCrc32, DataSignerMd5, OverheatLock, OverheatUnlock, SignerClock
+	t.Cleanup(func() {
+		DataSignerCrc32, DataSignerMd5, OverheatLock, OverheatUnlock, SignerClock = crc32Signer, md5Signer, lock, unlock, signerClock
+	})
+
+	DataSignerCrc32, DataSignerMd5 = commonDataSignerCrc32, commonDataSignerMd5
+	OverheatLock, OverheatUnlock = commonOverheatLock, commonOverheatUnlock
+	SignerClock = clock
+	return clock
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var woke uint32
+	wg := &sync.WaitGroup{}
+	for _, d := range []time.Duration{time.Second, 2 * time.Second} {
+		wg.Add(1)
+		go func(d time.Duration) {
+			defer wg.Done()
+			clock.Sleep(d)
+			atomic.AddUint32(&woke, 1)
+		}(d)
+	}
+
+	clock.BlockUntil(2)
+	clock.Advance(1500 * time.Millisecond)
+	for clock.Waiters() != 1 || atomic.LoadUint32(&woke) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if !clock.AdvanceNext() {
+		t.Fatal("expected pending timer")
+	}
+	wg.Wait()
+	if now := clock.Now(); !now.Equal(time.Unix(2, 0)) {
+		t.Errorf("expected clock at 2s, got %v", now)
+	}
+	if clock.AdvanceNext() {
+		t.Error("expected no pending timers")
+	}
+}
+
+// blockUntil - BlockUntil с пределом в реальном времени: если спящих меньше,
+// чем ждёт тест, он падает, а не висит
+func blockUntil(t *testing.T, clock *FakeClock, n int) {
+	t.Helper()
+	blocked := make(chan struct{})
+	go func() {
+		clock.BlockUntil(n)
+		close(blocked)
+	}()
+	select {
+	case <-blocked:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%d sleepers, expected %d", clock.Waiters(), n)
+	}
+}
+
+// TestSignerVirtualTime - TestSigner в виртуальном времени: проверка "меньше 3 секунд"
+// не зависит от загрузки машины и проходит за миллисекунды. Время сдвигается
+// только когда уснули все, кого ждёт очередной шаг.
+func TestSignerVirtualTime(t *testing.T) {
+	clock := fakeClock(t)
+
+	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	source := func(in, out chan interface{}) {
+		for _, fibNum := range inputData {
+			out <- fibNum
+		}
+	}
+
+	start, realStart := clock.Now(), time.Now()
+	var result string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ExecutePipeline(job(source), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&result))
+	}()
+
+	n := len(inputData)
+	// md5 идут по одному: перед k-м спят n crc32(data), k-1 crc32(md5) и сам md5
+	for k := 1; k <= n; k++ {
+		blockUntil(t, clock, n+k)
+		clock.Advance(10 * time.Millisecond)
+	}
+	// n crc32(data) и n crc32(md5), дальше по MultiCount crc32 на элемент
+	blockUntil(t, clock, 2*n)
+	clock.Advance(time.Second)
+	blockUntil(t, clock, n*DefaultConfig.MultiCount)
+	clock.Advance(time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("pipeline did not finish, %d sleepers left", clock.Waiters())
+	}
+	elapsed := clock.Now().Sub(start)
+
+	if result != testExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, testExpected)
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("execution too long\nGot: %s\nExpected: <%s", elapsed, 3*time.Second)
+	}
+	// crc32 и crc32(md5) идут последовательно, значит меньше 2 секунд быть не может
+	if elapsed < 2*time.Second {
+		t.Errorf("virtual time too short: %s", elapsed)
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("%d sleepers left", clock.Waiters())
+	}
+	if real := time.Since(realStart); real > time.Second {
+		t.Errorf("virtual run took %s of real time", real)
+	}
+}
+
+// TestTokenBucketCancelFakeClock - отменённое ожидание токена не оставляет таймер
+func TestTokenBucketCancelFakeClock(t *testing.T) {
+	clock := fakeClock(t)
+	b := NewTokenBucket(1, 1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() { waited <- b.Wait(ctx) }()
+	blockUntil(t, clock, 1)
+	cancel()
+	if err := <-waited; err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+	if n := clock.Waiters(); n != 0 {
+		t.Errorf("cancelled wait left %d timers", n)
+	}
+
+	// токен вернулся: следующий ждёт одну секунду, а не две
+	go func() { waited <- b.Wait(context.Background()) }()
+	blockUntil(t, clock, 1)
+	clock.Advance(time.Second)
+	if err := <-waited; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// Комбинаторы строят из job'ов нелинейные пайплайны. Все они сами являются job,
+// поэтому вкладываются друг в друга и в ExecutePipeline:
+//
+//	ExecutePipeline(source, FanOut(job(SingleHash), other), Partition(4, key, job(MultiHash)), sink)
+
+// startJob запускает j в отдельной горутине и возвращает его выходной канал,
+// который закрывается после завершения j. Если j вернулся, не дочитав in, остаток
+// вычитывается вхолостую, чтобы тот, кто пишет в in, не повис.
+func startJob(j job, in chan interface{}) chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer drain(in)
+		defer close(out)
+		j(in, out)
+	}()
+	return out
+}
+
+// FanIn сливает несколько каналов в один. Результат закрывается,
+// когда закрыты все входные каналы.
+func FanIn(chans ...chan interface{}) chan interface{} {
+	out := make(chan interface{})
+	wg := &sync.WaitGroup{}
+	for _, ch := range chans {
+		wg.Add(1)
+		go func(ch chan interface{}) {
+			defer wg.Done()
+			for v := range ch {
+				out <- v
+			}
+		}(ch)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// branches запускает jobs на собственных входах, а их выходы сливает в out.
+// dispatch раскладывает входные данные по входам веток.
+func branches(in, out chan interface{}, jobs []job, dispatch func(v interface{}, ins []chan interface{})) {
+	ins := make([]chan interface{}, len(jobs))
+	outs := make([]chan interface{}, len(jobs))
+	for i, j := range jobs {
+		ins[i] = make(chan interface{})
+		outs[i] = startJob(j, ins[i])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for v := range FanIn(outs...) {
+			out <- v
+		}
+	}()
+
+	for v := range in {
+		dispatch(v, ins)
+	}
+	for _, ch := range ins {
+		close(ch)
+	}
+	<-done
+}
+
+// FanOut отправляет каждое входное значение во все jobs и сливает их результаты
+func FanOut(jobs ...job) job {
+	return func(in, out chan interface{}) {
+		branches(in, out, jobs, func(v interface{}, ins []chan interface{}) {
+			for _, ch := range ins {
+				ch <- v
+			}
+		})
+	}
+}
+
+// Route отправляет значение в routes[key(v)]. Значения с неизвестным ключом
+// уходят в fallback, а если его нет - проходят дальше без изменений.
+func Route(key func(interface{}) string, routes map[string]job, fallback job) job {
+	if fallback == nil {
+		fallback = passThrough
+	}
+
+	names := make(map[string]int, len(routes))
+	jobs := make([]job, 0, len(routes)+1)
+	for name, j := range routes {
+		names[name] = len(jobs)
+		jobs = append(jobs, j)
+	}
+	fallbackIdx := len(jobs)
+	jobs = append(jobs, fallback)
+
+	return func(in, out chan interface{}) {
+		branches(in, out, jobs, func(v interface{}, ins []chan interface{}) {
+			i, ok := names[key(v)]
+			if !ok {
+				i = fallbackIdx
+			}
+			ins[i] <- v
+		})
+	}
+}
+
+// Partition запускает n копий stage и распределяет значения между ними по хешу key(v):
+// значения с одинаковым ключом всегда попадают в одну и ту же копию
+func Partition(n int, key func(interface{}) string, stage job) job {
+	if n < 1 {
+		n = 1
+	}
+	jobs := make([]job, n)
+	for i := range jobs {
+		jobs[i] = stage
+	}
+
+	return func(in, out chan interface{}) {
+		branches(in, out, jobs, func(v interface{}, ins []chan interface{}) {
+			h := fnv.New32a()
+			h.Write([]byte(key(v)))
+			ins[h.Sum32()%uint32(n)] <- v
+		})
+	}
+}
+
+// Tee передаёт значения дальше без изменений и отдаёт копию каждого в sink.
+// То, что выдаёт sink, отбрасывается.
+func Tee(sink job) job {
+	return func(in, out chan interface{}) {
+		sinkIn := make(chan interface{})
+		sinkOut := startJob(sink, sinkIn)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for range sinkOut {
+			}
+		}()
+
+		for v := range in {
+			sinkIn <- v
+			out <- v
+		}
+		close(sinkIn)
+		<-done
+	}
+}
+
+func passThrough(in, out chan interface{}) {
+	for v := range in {
+		out <- v
+	}
+}
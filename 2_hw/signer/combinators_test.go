@@ -0,0 +1,163 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func mapInts(f func(int) int) job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			out <- f(v.(int))
+		}
+	}
+}
+
+func collectInts(result *[]int) job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			*result = append(*result, v.(int))
+		}
+		sort.Ints(*result)
+	}
+}
+
+func TestFanIn(t *testing.T) {
+	a, b := make(chan interface{}), make(chan interface{})
+	go func() {
+		a <- 1
+		a <- 2
+		close(a)
+	}()
+	go func() {
+		b <- 3
+		close(b)
+	}()
+
+	var result []int
+	for v := range FanIn(a, b) {
+		result = append(result, v.(int))
+	}
+	sort.Ints(result)
+	if !reflect.DeepEqual(result, []int{1, 2, 3}) {
+		t.Errorf("got %v", result)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	var result []int
+	ExecutePipeline(
+		intSource(3),
+		FanOut(mapInts(func(i int) int { return i * 10 }), mapInts(func(i int) int { return i * 100 })),
+		collectInts(&result),
+	)
+
+	expected := []int{0, 0, 10, 20, 100, 200}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, expected %v", result, expected)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	parity := func(v interface{}) string {
+		if v.(int)%2 == 0 {
+			return "even"
+		}
+		return "odd"
+	}
+	negate := mapInts(func(i int) int { return -i })
+
+	var result []int
+	ExecutePipeline(intSource(5), Route(parity, map[string]job{"odd": negate}, nil), collectInts(&result))
+
+	expected := []int{-3, -1, 0, 2, 4}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %v, expected %v", result, expected)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	mu := &sync.Mutex{}
+	seen := make(map[string]map[int]bool) // ключ -> номера копий стадии, которые его видели
+	var instance int
+	stage := func(in, out chan interface{}) {
+		mu.Lock()
+		id := instance
+		instance++
+		mu.Unlock()
+
+		for v := range in {
+			key := strconv.Itoa(v.(int) % 3)
+			mu.Lock()
+			if seen[key] == nil {
+				seen[key] = make(map[int]bool)
+			}
+			seen[key][id] = true
+			mu.Unlock()
+			out <- v
+		}
+	}
+	key := func(v interface{}) string { return strconv.Itoa(v.(int) % 3) }
+
+	var result []int
+	ExecutePipeline(intSource(30), Partition(4, key, stage), collectInts(&result))
+
+	if len(result) != 30 {
+		t.Errorf("expected 30 values, got %d", len(result))
+	}
+	if instance != 4 {
+		t.Errorf("expected 4 stage instances, got %d", instance)
+	}
+	for k, ids := range seen {
+		if len(ids) != 1 {
+			t.Errorf("key %s was processed by %d instances", k, len(ids))
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	var side, result []int
+	ExecutePipeline(intSource(4), Tee(collectInts(&side)), mapInts(func(i int) int { return i + 1 }), collectInts(&result))
+
+	if !reflect.DeepEqual(side, []int{0, 1, 2, 3}) {
+		t.Errorf("tee sink got %v", side)
+	}
+	if !reflect.DeepEqual(result, []int{1, 2, 3, 4}) {
+		t.Errorf("got %v", result)
+	}
+}
+
+// takeInts берёт n значений и возвращается, не дочитав вход
+func takeInts(n int, result *[]int) job {
+	return func(in, out chan interface{}) {
+		for ; n > 0; n-- {
+			*result = append(*result, (<-in).(int))
+		}
+	}
+}
+
+// TestEarlyReturn - ветка или sink, вернувшиеся раньше времени, не останавливают пайплайн
+func TestEarlyReturn(t *testing.T) {
+	noGoroutineLeaks(t)
+
+	var first, side, result []int
+	ExecutePipeline(intSource(5), FanOut(takeInts(1, &first), passThrough), collectInts(&result))
+	if !reflect.DeepEqual(first, []int{0}) || !reflect.DeepEqual(result, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("fan-out: branch got %v, result %v", first, result)
+	}
+
+	result = nil
+	ExecutePipeline(intSource(5), Tee(takeInts(2, &side)), collectInts(&result))
+	if !reflect.DeepEqual(side, []int{0, 1}) || !reflect.DeepEqual(result, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("tee: sink got %v, result %v", side, result)
+	}
+
+	result = nil
+	ExecutePipeline(intSource(5), takeInts(0, nil), collectInts(&result))
+	if len(result) != 0 {
+		t.Errorf("stage after early return got %v", result)
+	}
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"hash/crc32"
 	"strconv"
-	"sync/atomic"
 	"time"
 )
 
@@ -16,38 +16,48 @@ const (
 )
 
 var (
+	// флаг перегрева для OverheatLock на CAS из задания, им проверяет TestSigner
 	dataSignerOverheat uint32 = 0
 	DataSignerSalt            = ""
 )
 
+// Md5Resource ограничивает параллельные вызовы DataSignerMd5. Ёмкость и темп
+// настраиваются заменой ресурса, например NewResource(1, NewTokenBucket(50, 1)).
+var Md5Resource = NewResource(1, nil)
+
+// OverheatLock ждёт Md5Resource без отмены, ожидание с отменой - DataSignerMd5Context
 var OverheatLock = func() {
-	for {
-		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1); !swapped {
-			fmt.Println("OverheatLock happend")
-			time.Sleep(time.Second)
-		} else {
-			break
-		}
+	// Acquire ошибается только при отмене ctx, а Background не отменяется
+	if err := Md5Resource.Acquire(context.Background()); err != nil {
+		panic(err)
 	}
 }
 
 var OverheatUnlock = func() {
-	for {
-		if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 1, 0); !swapped {
-			fmt.Println("OverheatUnlock happend")
-			time.Sleep(time.Second)
-		} else {
-			break
-		}
-	}
+	Md5Resource.Release()
 }
 
 var DataSignerMd5 = func(data string) string {
 	OverheatLock()
 	defer OverheatUnlock()
+	return md5Sign(data)
+}
+
+// DataSignerMd5Context - DataSignerMd5, который перестаёт ждать Md5Resource,
+// когда отменён ctx, и возвращает ошибку ctx. Дождавшись, вызывает DataSignerMd5,
+// так что его подмены работают и здесь.
+func DataSignerMd5Context(ctx context.Context, data string) (string, error) {
+	if err := Md5Resource.Reserve(ctx); err != nil {
+		return "", err
+	}
+	defer Md5Resource.Unreserve()
+	return DataSignerMd5(data), nil
+}
+
+func md5Sign(data string) string {
 	data += DataSignerSalt
 	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
-	time.Sleep(10 * time.Millisecond)
+	SignerClock.Sleep(10 * time.Millisecond)
 	return dataHash
 }
 
@@ -55,6 +65,6 @@ var DataSignerCrc32 = func(data string) string {
 	data += DataSignerSalt
 	crcH := crc32.ChecksumIEEE([]byte(data))
 	dataHash := strconv.FormatUint(uint64(crcH), 10)
-	time.Sleep(time.Second)
+	SignerClock.Sleep(time.Second)
 	return dataHash
 }
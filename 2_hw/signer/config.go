@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// SingleHash: Outer(data)~Outer(Inner(data))
+// MultiHash: Multi(th+data), th=0..MultiCount-1
+type Config struct {
+	Outer      Algorithm
+	Inner      Algorithm
+	Multi      Algorithm
+	MultiCount int
+
+	Salt string      // дописывается к данным каждой подписи, как DataSignerSalt, но только у этого Signer
+	Log  *log.Logger // шаги подписи и отбракованные элементы, nil - стандартный логгер пакета log
+}
+
+var DefaultConfig = Config{
+	Outer:      Crc32,
+	Inner:      Md5,
+	Multi:      Crc32,
+	MultiCount: 6,
+}
+
+func (c Config) Validate() error {
+	for _, a := range []Algorithm{c.Outer, c.Inner, c.Multi} {
+		if !a.valid() {
+			return fmt.Errorf("unknown hash algorithm %q", a)
+		}
+	}
+	if c.MultiCount < 1 {
+		return fmt.Errorf("multi hash count must be positive, got %d", c.MultiCount)
+	}
+	return nil
+}
+
+type Signer struct {
+	cfg Config
+
+	Checkpoint *Checkpoint // если задан, результаты сохраняются и переиспользуются между запусками
+	Cache      *Memo       // если задан, вызовы DataSigner* с одинаковыми данными не повторяются в пределах процесса
+
+	Concurrency int // сколько элементов одна стадия обрабатывает одновременно, 0 - без ограничений
+
+	DeadLetters DeadLetterSink // куда стадии отправляют элементы, которые не смогли обработать
+
+	// Context прерывает ожидание DataSignerMd5: элемент, который не дождался
+	// его до отмены, уходит в DeadLetters. nil - ждать без отмены.
+	Context context.Context
+}
+
+func NewSigner(cfg Config) (*Signer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newSigner(cfg), nil
+}
+
+func newSigner(cfg Config) *Signer {
+	return &Signer{cfg: cfg}
+}
+
+// DefaultSigner - Signer пакетных SingleHash, MultiHash и CombineResults.
+// Его поля (DeadLetters, Cache, Checkpoint, ...) настраиваются до запуска пайплайна.
+var DefaultSigner = newSigner(DefaultConfig)
+
+func (s *Signer) sign(a Algorithm, data string) (string, error) {
+	if s.Cache == nil {
+		return s.signDirect(a, data)
+	}
+	// соль влияет на результат, поэтому входит в ключ
+	key := string(a) + "\x00" + DataSignerSalt + "\x00" + data + s.cfg.Salt
+	return s.Cache.Do(key, func() (string, error) {
+		return s.signDirect(a, data)
+	})
+}
+
+func (s *Signer) signDirect(a Algorithm, data string) (string, error) {
+	data += s.cfg.Salt
+	if a.exclusive() {
+		// ждём Md5Resource, один на процесс: перегревается сама функция, поэтому
+		// независимые Signer и пакетные стадии ждут друг друга
+		ctx := s.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return DataSignerMd5Context(ctx, data)
+	}
+	return a.signer()(data), nil
+}
+
+func (s *Signer) logf(format string, v ...interface{}) {
+	if s.cfg.Log != nil {
+		s.cfg.Log.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// slots ограничивает число одновременно обрабатываемых элементов стадии
+type slots chan struct{}
+
+func (s *Signer) slots() slots {
+	if s.Concurrency <= 0 {
+		return nil
+	}
+	return make(slots, s.Concurrency)
+}
+
+func (sl slots) acquire() {
+	if sl != nil {
+		sl <- struct{}{}
+	}
+}
+
+func (sl slots) release() {
+	if sl != nil {
+		<-sl
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig.Validate(); err != nil {
+		t.Errorf("default config must be valid: %v", err)
+	}
+
+	bad := []Config{
+		{Outer: "sha1", Inner: Md5, Multi: Crc32, MultiCount: 6},
+		{Outer: Crc32, Inner: "", Multi: Crc32, MultiCount: 6},
+		{Outer: Crc32, Inner: Md5, Multi: Crc32, MultiCount: 0},
+	}
+	for _, cfg := range bad {
+		if _, err := NewSigner(cfg); err == nil {
+			t.Errorf("expected error for config %+v", cfg)
+		}
+	}
+}
+
+func TestSignerCustomAlgorithms(t *testing.T) {
+	sha := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+	xx := func(s string) string { return strconv.FormatUint(xxhash.Sum64String(s), 10) }
+
+	s, err := NewSigner(Config{Outer: Xxhash, Inner: Sha256, Multi: Xxhash, MultiCount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) { out <- 7 }),
+		job(s.SingleHash),
+		job(s.MultiHash),
+		job(func(in, out chan interface{}) {
+			for data := range in {
+				result = data.(string)
+			}
+		}),
+	)
+
+	step1 := xx("7") + "~" + xx(sha("7"))
+	expected := xx("0"+step1) + xx("1"+step1) + xx("2"+step1)
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// TestMd5LimitShared - у независимых Signer и пакетных стадий один лимит на DataSignerMd5
+func TestMd5LimitShared(t *testing.T) {
+	fastSigners(t, 5*time.Millisecond)
+	md5Signer := DataSignerMd5
+	var running, overlaps int32
+	DataSignerMd5 = func(data string) string {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+		return md5Signer(data)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, s := range []*Signer{newSigner(DefaultConfig), newSigner(DefaultConfig), DefaultSigner} {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(s *Signer, i int) {
+				defer wg.Done()
+				s.sign(Md5, strconv.Itoa(i))
+			}(s, i)
+		}
+	}
+	wg.Wait()
+
+	if overlaps != 0 {
+		t.Errorf("DataSignerMd5 ran concurrently %d times", overlaps)
+	}
+}
+
+// TestConfigSalt - Config.Salt подписывает так же, как DataSignerSalt, не меняя её
+func TestConfigSalt(t *testing.T) {
+	fastSigners(t, 0)
+	cfg := DefaultConfig
+	cfg.Salt = "salt"
+	got, err := newSigner(cfg).singleHash("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DataSignerSalt = "salt"
+	defer func() { DataSignerSalt = "" }()
+	expected, err := newSigner(DefaultConfig).singleHash("7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
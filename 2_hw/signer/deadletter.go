@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DeadLetter - элемент, который стадия не смогла обработать
+type DeadLetter struct {
+	Stage  string
+	Item   interface{}
+	Reason string
+}
+
+func (d DeadLetter) String() string {
+	return fmt.Sprintf("%s: %#v: %s", d.Stage, d.Item, d.Reason)
+}
+
+// DeadLetterSink принимает отбракованные элементы. Если у стадии он не задан,
+// элемент пишется в лог и выбрасывается.
+type DeadLetterSink interface {
+	Put(d DeadLetter)
+}
+
+// DeadLetterChan отправляет отбракованные элементы в канал; читать его нужно
+// параллельно с пайплайном, иначе стадия встанет на отправке
+type DeadLetterChan chan DeadLetter
+
+func (c DeadLetterChan) Put(d DeadLetter) {
+	c <- d
+}
+
+// DeadLetterQueue копит отбракованные элементы для просмотра и повторной отправки
+type DeadLetterQueue struct {
+	mu    sync.Mutex
+	items []DeadLetter
+}
+
+func (q *DeadLetterQueue) Put(d DeadLetter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, d)
+}
+
+func (q *DeadLetterQueue) Items() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetter(nil), q.items...)
+}
+
+func (q *DeadLetterQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Replay - источник для нового пайплайна: забирает накопленные элементы из очереди
+// и отправляет их дальше как есть (исправить их можно следующей стадией)
+func (q *DeadLetterQueue) Replay(in, out chan interface{}) {
+	q.mu.Lock()
+	items := q.items
+	q.items = nil
+	q.mu.Unlock()
+
+	for _, d := range items {
+		out <- d.Item
+	}
+}
+
+func putDeadLetter(sink DeadLetterSink, logf func(string, ...interface{}), stage string, item interface{}, reason string) {
+	d := DeadLetter{Stage: stage, Item: item, Reason: reason}
+	if sink == nil {
+		logf("dead letter %s\n", d)
+		return
+	}
+	sink.Put(d)
+}
+
+func (s *Signer) reject(stage string, item interface{}, reason string) {
+	putDeadLetter(s.DeadLetters, s.logf, stage, item, reason)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	fastSigners(t, 0)
+	s := newSigner(DefaultConfig)
+	dead := &DeadLetterQueue{}
+	s.DeadLetters = dead
+
+	source := func(in, out chan interface{}) {
+		for _, v := range []interface{}{0, "1", 2.5, nil, 3} {
+			out <- v
+		}
+	}
+	var count int
+	ExecutePipeline(job(source), job(s.SingleHash), job(s.MultiHash), job(func(in, out chan interface{}) {
+		for range in {
+			count++
+		}
+	}))
+
+	if count != 3 {
+		t.Errorf("expected 3 results, got %d", count)
+	}
+	items := dead.Items()
+	if len(items) != 2 {
+		t.Fatalf("expected 2 dead letters, got %v", items)
+	}
+	for _, d := range items {
+		if d.Stage != "SingleHash" || !strings.Contains(d.Reason, "unsupported type") {
+			t.Errorf("unexpected dead letter %s", d)
+		}
+	}
+
+	// повторная отправка: исправляем элементы и прогоняем их заново
+	fix := func(in, out chan interface{}) {
+		for v := range in {
+			if f, ok := v.(float64); ok {
+				out <- int(f)
+				continue
+			}
+			out <- fmt.Sprint(v)
+		}
+	}
+	var replayed []string
+	ExecutePipeline(job(dead.Replay), job(fix), job(s.SingleHash), job(func(in, out chan interface{}) {
+		for v := range in {
+			replayed = append(replayed, v.(string))
+		}
+	}))
+	if len(replayed) != 2 || dead.Len() != 0 {
+		t.Errorf("replay: got %v, %d left in queue", replayed, dead.Len())
+	}
+}
+
+func TestDeadLettersMultiHashAndCombine(t *testing.T) {
+	fastSigners(t, 0)
+	s := newSigner(DefaultConfig)
+	dead := make(DeadLetterChan, 10)
+	s.DeadLetters = dead
+
+	var result string
+	ExecutePipeline(intSource(2), job(s.MultiHash), job(func(in, out chan interface{}) {
+		for v := range in {
+			out <- v
+		}
+		out <- "a"
+		out <- 42
+	}), job(s.CombineResults), collectResult(&result))
+	close(dead)
+
+	if result != "a" {
+		t.Errorf("expected only valid item combined, got %q", result)
+	}
+	stages := map[string]int{}
+	for d := range dead {
+		stages[d.Stage]++
+	}
+	if stages["MultiHash"] != 2 || stages["CombineResults"] != 1 {
+		t.Errorf("unexpected dead letters by stage: %v", stages)
+	}
+}
+
+// TestDefaultSignerDeadLetters - пакетные стадии отбраковывают в DefaultSigner.DeadLetters
+func TestDefaultSignerDeadLetters(t *testing.T) {
+	fastSigners(t, 0)
+	dead := &DeadLetterQueue{}
+	DefaultSigner.DeadLetters = dead
+	defer func() { DefaultSigner.DeadLetters = nil }()
+
+	source := func(in, out chan interface{}) {
+		for _, v := range []interface{}{0, 2.5} {
+			out <- v
+		}
+	}
+	var result string
+	ExecutePipeline(job(source), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&result))
+
+	if result == "" {
+		t.Error("expected result for the valid item")
+	}
+	if items := dead.Items(); len(items) != 1 || items[0].Stage != "SingleHash" || items[0].Item != 2.5 {
+		t.Errorf("unexpected dead letters %v", items)
+	}
+}
+
+func TestRemoteStageDeadLetters(t *testing.T) {
+	e := localEndpoint(t)
+	dead := &DeadLetterQueue{}
+	remote := &RemoteStage{Stage: "SingleHash", Endpoints: []Endpoint{e}, MaxRetries: 1, Backoff: time.Millisecond, DeadLetters: dead}
+	ExecutePipeline(intSource(3), job(remote.Run), job(func(in, out chan interface{}) {
+		for range in {
+		}
+	}))
+
+	items := dead.Items()
+	if len(items) != 3 {
+		t.Fatalf("expected 3 dead letters without endpoints, got %v", items)
+	}
+	for _, d := range items {
+		if d.Stage != "SingleHash" || d.Reason != noEndpointsReason {
+			t.Errorf("unexpected dead letter %s", d)
+		}
+	}
+}
@@ -1,3 +1,5 @@
 module hw
 
 go 1.17
+
+require github.com/cespare/xxhash/v2 v2.1.2
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+type Algorithm string
+
+const (
+	Crc32  Algorithm = "crc32"
+	Md5    Algorithm = "md5"
+	Sha256 Algorithm = "sha256"
+	Xxhash Algorithm = "xxhash"
+)
+
+var DataSignerSha256 = func(data string) string {
+	data += DataSignerSalt
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+var DataSignerXxhash = func(data string) string {
+	data += DataSignerSalt
+	return strconv.FormatUint(xxhash.Sum64String(data), 10)
+}
+
+// signer возвращает функцию подписи в момент вызова,
+// чтобы подмена DataSigner* (как в тестах) подхватывалась
+func (a Algorithm) signer() func(string) string {
+	switch a {
+	case Crc32:
+		return DataSignerCrc32
+	case Md5:
+		return DataSignerMd5
+	case Sha256:
+		return DataSignerSha256
+	case Xxhash:
+		return DataSignerXxhash
+	}
+	return nil
+}
+
+// exclusive: DataSignerMd5 перегревается, вызовы ждут Md5Resource
+func (a Algorithm) exclusive() bool {
+	return a == Md5
+}
+
+func (a Algorithm) valid() bool {
+	return a.signer() != nil
+}
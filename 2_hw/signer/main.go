@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+const usage = `usage:
+  signer sign [-salt ...] [-concurrency N] [-format text|json] [-mode combine|lines] [-v] [file ...]
+  signer worker -listen tcp://127.0.0.1:7000 [-salt ...]
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "sign":
+		err = runSign(os.Args[2:], os.Stdin, os.Stdout, os.Stderr)
+	case "worker":
+		err = runWorker(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runWorker(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	listen := fs.String("listen", "tcp://127.0.0.1:7000", "address to listen on, tcp://host:port or unix:///path")
+	salt := fs.String("salt", "", "salt appended to signed data, must match the coordinator")
+	fs.Parse(args)
+
+	e, err := ParseEndpoint(*listen)
+	if err != nil {
+		return err
+	}
+	l, err := e.Listen()
+	if err != nil {
+		return err
+	}
+
+	cfg := DefaultConfig
+	cfg.Salt = *salt
+	log.Printf("worker listening on %s\n", e)
+	return NewWorker(newSigner(cfg)).Serve(l)
+}
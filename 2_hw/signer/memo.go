@@ -0,0 +1,111 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// Memo - LRU-кеш результатов подписи на size ключей. Одновременные запросы
+// одного и того же ключа ждут первый вызов, а не считают параллельно (singleflight).
+// Кеш живёт только в памяти процесса; между запусками результаты стадий
+// переиспользует Checkpoint.
+type Memo struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // *memoEntry, самые свежие в начале
+	items map[string]*list.Element
+	calls map[string]*memoCall
+	stats MemoStats
+}
+
+type MemoStats struct {
+	Hits      int64 // результат взят из кеша
+	Shared    int64 // дождались вызова, начатого другой горутиной
+	Misses    int64 // пришлось вызвать функцию
+	Evictions int64
+}
+
+type memoEntry struct {
+	key   string
+	value string
+}
+
+type memoCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+var errMemoPanic = errors.New("memo: call panicked")
+
+func NewMemo(size int) *Memo {
+	if size < 1 {
+		size = 1
+	}
+	return &Memo{
+		size:  size,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+		calls: make(map[string]*memoCall),
+	}
+}
+
+// Do возвращает результат fn для key. Ошибка не кешируется: её получают
+// только те, кто дождался этого вызова, следующий Do вызовет fn заново.
+func (m *Memo) Do(key string, fn func() (string, error)) (string, error) {
+	m.mu.Lock()
+	if el, ok := m.items[key]; ok {
+		m.lru.MoveToFront(el)
+		m.stats.Hits++
+		m.mu.Unlock()
+		return el.Value.(*memoEntry).value, nil
+	}
+	if call, ok := m.calls[key]; ok {
+		m.stats.Shared++
+		m.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &memoCall{done: make(chan struct{})}
+	m.calls[key] = call
+	m.stats.Misses++
+	m.mu.Unlock()
+
+	// если fn паникует, паника уходит вызывающему, а ждущие получают ошибку
+	call.err = errMemoPanic
+	defer func() {
+		m.mu.Lock()
+		delete(m.calls, key)
+		if call.err == nil {
+			m.add(key, call.value)
+		}
+		m.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = fn()
+	return call.value, call.err
+}
+
+func (m *Memo) add(key, value string) {
+	m.items[key] = m.lru.PushFront(&memoEntry{key: key, value: value})
+	for m.lru.Len() > m.size {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoEntry).key)
+		m.stats.Evictions++
+	}
+}
+
+func (m *Memo) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *Memo) Stats() MemoStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoSingleflight(t *testing.T) {
+	calls := countingSigners(t, 20*time.Millisecond)
+	s := newSigner(DefaultConfig)
+	s.Cache = NewMemo(10)
+
+	results := make([]string, 10)
+	wg := &sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = s.sign(Crc32, "data")
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadUint32(calls); got != 1 {
+		t.Errorf("expected 1 underlying crc32 call, got %d", got)
+	}
+	for _, r := range results {
+		if r != results[0] {
+			t.Errorf("concurrent callers got different results: %v", results)
+			break
+		}
+	}
+	stats := s.Cache.Stats()
+	if stats.Misses != 1 || stats.Hits+stats.Shared != 9 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMemoEviction(t *testing.T) {
+	m := NewMemo(2)
+	var calls int
+	value := func(v string) func() (string, error) {
+		return func() (string, error) {
+			calls++
+			return v, nil
+		}
+	}
+
+	m.Do("a", value("1"))
+	m.Do("b", value("2"))
+	m.Do("a", value("1")) // a свежее b
+	m.Do("c", value("3")) // вытесняет b
+	m.Do("a", value("1"))
+	m.Do("b", value("2"))
+
+	if calls != 4 {
+		t.Errorf("expected 4 calls, got %d", calls)
+	}
+	if m.Len() != 2 {
+		t.Errorf("expected 2 cached keys, got %d", m.Len())
+	}
+	stats := m.Stats()
+	if stats.Hits != 2 || stats.Misses != 4 || stats.Evictions != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// TestMemoPanic - паника fn не оставляет ждущих и следующие вызовы висеть
+func TestMemoPanic(t *testing.T) {
+	m := NewMemo(10)
+	start := make(chan struct{})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		m.Do("key", func() (string, error) {
+			<-start
+			panic("boom")
+		})
+	}()
+
+	for m.Stats().Misses == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	shared := make(chan error)
+	go func() {
+		_, err := m.Do("key", func() (string, error) { return "unused", nil })
+		shared <- err
+	}()
+	for m.Stats().Shared == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(start)
+
+	if r := <-panicked; r != "boom" {
+		t.Errorf("expected panic to reach the caller, got %v", r)
+	}
+	select {
+	case err := <-shared:
+		if err != errMemoPanic {
+			t.Errorf("waiter got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter blocked after panic")
+	}
+	if v, err := m.Do("key", func() (string, error) { return "ok", nil }); v != "ok" || err != nil {
+		t.Errorf("after panic: got %q, %v", v, err)
+	}
+}
+
+func TestMemoPipeline(t *testing.T) {
+	calls := countingSigners(t, 10*time.Millisecond)
+	input := []int{0, 1, 1, 2}
+	source := func(in, out chan interface{}) {
+		for _, v := range input {
+			out <- v
+		}
+	}
+
+	var expected string
+	ExecutePipeline(job(source), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&expected))
+	atomic.StoreUint32(calls, 0)
+
+	s := newSigner(DefaultConfig)
+	s.Cache = NewMemo(100)
+	var result string
+	ExecutePipeline(job(source), job(s.SingleHash), job(s.MultiHash), job(CombineResults), collectResult(&result))
+
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+	// 3 уникальных входа по 8 crc32
+	if got := atomic.LoadUint32(calls); got != 3*8 {
+		t.Errorf("expected %d crc32 calls, got %d", 3*8, got)
+	}
+}
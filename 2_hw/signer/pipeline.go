@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Pipeline - ExecutePipeline с остановкой. Между стадиями стоят ретрансляторы, которые:
+//   - после Shutdown перестают читать первую стадию (источник) и ждут, пока она
+//     завершится по Stopping(); всё, что источник успел отправить, доходит дальше;
+//   - после отказа от ожидания (дедлайн Shutdown) закрывают вход следующей стадии и
+//     вычитывают предыдущую вхолостую, чтобы никто не остался висеть на out <-;
+//   - вычитывают вход стадии, которая завершилась, не дочитав его.
+//
+// Бесконечный источник должен сам завершаться по Stopping().
+type Pipeline struct {
+	jobs []job
+
+	stopOnce    sync.Once
+	stopping    chan struct{}
+	abandonOnce sync.Once
+	abandoned   chan struct{}
+	done        chan struct{}
+	finished    chan struct{}
+}
+
+func NewPipeline(jobs ...job) *Pipeline {
+	return &Pipeline{
+		jobs:      jobs,
+		stopping:  make(chan struct{}),
+		abandoned: make(chan struct{}),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+}
+
+// Run запускает стадии и ждёт, пока все они (и ретрансляторы) не завершатся
+// или пока Shutdown не откажется от ожидания
+func (p *Pipeline) Run() {
+	defer close(p.done)
+	if len(p.jobs) == 0 {
+		close(p.finished)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	// у источника входа нет, закрытый канал не держит его горутину
+	in := make(chan interface{})
+	close(in)
+	for i, j := range p.jobs {
+		var exited <-chan struct{}
+		in, exited = p.startJob(wg, j, in)
+		if i == len(p.jobs)-1 {
+			break
+		}
+
+		next := make(chan interface{})
+		var stop <-chan struct{}
+		if i == 0 {
+			stop = p.stopping
+		}
+		wg.Add(1)
+		go p.relay(wg, in, next, stop, exited)
+		in = next
+	}
+
+	go func() {
+		drain(in)
+		wg.Wait()
+		close(p.finished)
+	}()
+
+	select {
+	case <-p.finished:
+	case <-p.abandoned:
+	}
+}
+
+// startJob возвращает выход j и канал, который закрывается, когда j вернулся
+func (p *Pipeline) startJob(wg *sync.WaitGroup, j job, in chan interface{}) (chan interface{}, <-chan struct{}) {
+	out := make(chan interface{})
+	exited := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer drain(in)
+		defer close(exited)
+		defer close(out)
+		j(in, out)
+	}()
+	return out, exited
+}
+
+// relay передаёт up в down. По stop перестаёт читать up и ждёт upExited: принятый
+// из up элемент всегда отправляется дальше, выбрасывает их только отказ от ожидания.
+func (p *Pipeline) relay(wg *sync.WaitGroup, up, down chan interface{}, stop, upExited <-chan struct{}) {
+	defer wg.Done()
+	defer drain(up)
+	defer close(down)
+	for {
+		select {
+		case <-stop:
+			p.waitExited(upExited)
+			return
+		case <-p.abandoned:
+			return
+		default:
+		}
+
+		select {
+		case v, ok := <-up:
+			if !ok {
+				return
+			}
+			select {
+			case down <- v:
+			case <-p.abandoned:
+				return
+			}
+		case <-stop:
+			p.waitExited(upExited)
+			return
+		case <-p.abandoned:
+			return
+		}
+	}
+}
+
+// waitExited ждёт, пока источник вернётся, не читая его выход; источник, который
+// не смотрит на Stopping(), так и висит на out <-, пока Shutdown не откажется ждать
+func (p *Pipeline) waitExited(exited <-chan struct{}) {
+	select {
+	case <-exited:
+	case <-p.abandoned:
+	}
+}
+
+func drain(ch chan interface{}) {
+	for range ch {
+	}
+}
+
+// Stopping закрывается, когда вызван Shutdown
+func (p *Pipeline) Stopping() <-chan struct{} {
+	return p.stopping
+}
+
+// Done закрывается, когда Run вернулся
+func (p *Pipeline) Done() <-chan struct{} {
+	return p.done
+}
+
+// Finished закрывается, когда завершились все стадии, в том числе брошенные Shutdown
+func (p *Pipeline) Finished() <-chan struct{} {
+	return p.finished
+}
+
+// Shutdown перестаёт принимать данные от источника и ждёт, пока уже принятые
+// пройдут пайплайн. Если ctx истёк раньше, пайплайн бросается: Run возвращается сразу,
+// а оставшиеся элементы вычитываются и выбрасываются в фоне, пока стадии не завершатся.
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stopping) })
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		p.abandonOnce.Do(func() { close(p.abandoned) })
+		<-p.done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noGoroutineLeaks запоминает горутины на старте теста и в конце проверяет, что новых
+// не осталось. Cleanup выполняются в обратном порядке, поэтому подмены вроде fastSigners
+// нужно делать до вызова, иначе они откатятся раньше, чем доработают горутины.
+func noGoroutineLeaks(t *testing.T) {
+	before := goroutines()
+	t.Cleanup(func() {
+		var leaked []string
+		for deadline := time.Now().Add(3 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+		}
+		if len(leaked) > 0 {
+			t.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	})
+}
+
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	result := make(map[string]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		// goroutine 42 [chan send]:
+		header := string(stack[:bytes.IndexByte(stack, '\n')])
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		result[fields[1]] = string(stack)
+	}
+	return result
+}
+
+func TestPipelineRun(t *testing.T) {
+	fastSigners(t, 0)
+	noGoroutineLeaks(t)
+
+	var expected string
+	ExecutePipeline(intSource(5), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&expected))
+
+	var result string
+	NewPipeline(intSource(5), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&result)).Run()
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestPipelineConsumerStops(t *testing.T) {
+	fastSigners(t, 0)
+	noGoroutineLeaks(t)
+
+	var first string
+	NewPipeline(intSource(10), job(SingleHash), job(MultiHash), job(func(in, out chan interface{}) {
+		first = (<-in).(string)
+	})).Run()
+
+	if first == "" {
+		t.Error("consumer got nothing")
+	}
+}
+
+func TestPipelineShutdownDrains(t *testing.T) {
+	fastSigners(t, 0)
+	noGoroutineLeaks(t)
+
+	var p *Pipeline
+	var sent, received int
+	source := func(in, out chan interface{}) {
+		for i := 0; ; i++ {
+			select {
+			case out <- i:
+				sent++
+			case <-p.Stopping():
+				return
+			}
+		}
+	}
+	p = NewPipeline(job(source), job(SingleHash), job(func(in, out chan interface{}) {
+		for range in {
+			received++
+		}
+	}))
+	go p.Run()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown without deadline failed: %v", err)
+	}
+	if received == 0 || received != sent {
+		t.Errorf("sent %d, received %d", sent, received)
+	}
+}
+
+func TestPipelineShutdownDeadline(t *testing.T) {
+	fastSigners(t, 200*time.Millisecond)
+	noGoroutineLeaks(t)
+
+	p := NewPipeline(intSource(5), job(SingleHash), job(MultiHash), job(CombineResults))
+	go p.Run()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("abandon took %s", elapsed)
+	}
+	select {
+	case <-p.Done():
+	default:
+		t.Error("Run must return after abandon")
+	}
+
+	// брошенные элементы досчитываются в фоне, дожидаемся их до отката fastSigners
+	<-p.Finished()
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// RemoteStage - стадия пайплайна, которая отправляет данные на воркеры (см. Worker)
+// и выдаёт их результаты. Элементы распределяются между Endpoints по мере готовности
+// соединений; при обрыве неподтверждённые элементы отправляются заново после переподключения.
+//
+//	remote := &RemoteStage{Stage: "MultiHash", Endpoints: endpoints}
+//	ExecutePipeline(source, job(SingleHash), job(remote.Run), job(CombineResults), sink)
+type RemoteStage struct {
+	Stage     string
+	Endpoints []Endpoint
+
+	MaxRetries  int           // подряд неудачных подключений до отказа от эндпоинта, по умолчанию 5
+	Backoff     time.Duration // начальная пауза между попытками, удваивается, по умолчанию 50ms
+	DialTimeout time.Duration // по умолчанию 1s
+
+	DeadLetters DeadLetterSink // элементы, которые воркер не смог обработать или некому отправить
+}
+
+const maxRemoteBackoff = 2 * time.Second
+
+func (r *RemoteStage) Run(in, out chan interface{}) {
+	q := newRemoteQueue(func(item interface{}, reason string) {
+		putDeadLetter(r.DeadLetters, log.Printf, r.Stage, item, reason)
+	})
+
+	var endpoints sync.WaitGroup
+	var aliveMu sync.Mutex
+	alive := len(r.Endpoints)
+	if alive == 0 {
+		q.kill()
+	}
+	for _, e := range r.Endpoints {
+		endpoints.Add(1)
+		go func(e Endpoint) {
+			defer endpoints.Done()
+			r.serveEndpoint(e, q, out)
+
+			aliveMu.Lock()
+			defer aliveMu.Unlock()
+			if alive--; alive == 0 {
+				q.kill()
+			}
+		}(e)
+	}
+
+	var id uint64
+	for inData := range in {
+		id++
+		q.push(remoteItem{id: id, value: inData})
+	}
+
+	q.wait()
+	q.close()
+	endpoints.Wait()
+}
+
+func (r *RemoteStage) serveEndpoint(e Endpoint, q *remoteQueue, out chan interface{}) {
+	backoff := r.backoff()
+	failures := 0
+	for !q.isClosed() {
+		conn, err := r.dial(e)
+		if err != nil {
+			failures++
+			if failures >= r.maxRetries() {
+				log.Printf("remote %s %s: giving up after %d attempts: %v\n", r.Stage, e, failures, err)
+				return
+			}
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxRemoteBackoff {
+				backoff = maxRemoteBackoff
+			}
+			continue
+		}
+
+		failures, backoff = 0, r.backoff()
+		sess := &remoteSession{conn: conn, q: q, inflight: make(map[uint64]remoteItem)}
+		if err := sess.run(out); err != errSessionClosed {
+			log.Printf("remote %s %s: %v, reconnecting\n", r.Stage, e, err)
+		}
+	}
+}
+
+func (r *RemoteStage) dial(e Endpoint) (net.Conn, error) {
+	conn, err := net.DialTimeout(e.Network, e.Address, r.dialTimeout())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFrame(conn, frame{typ: frameHello, payload: []byte(r.Stage)}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(r.dialTimeout()))
+	ack, err := newFrameReader(conn).read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	if ack.typ != frameHello {
+		conn.Close()
+		return nil, fmt.Errorf("handshake rejected: %s", ack.payload)
+	}
+	return conn, nil
+}
+
+func (r *RemoteStage) maxRetries() int {
+	if r.MaxRetries > 0 {
+		return r.MaxRetries
+	}
+	return 5
+}
+
+func (r *RemoteStage) backoff() time.Duration {
+	if r.Backoff > 0 {
+		return r.Backoff
+	}
+	return 50 * time.Millisecond
+}
+
+func (r *RemoteStage) dialTimeout() time.Duration {
+	if r.DialTimeout > 0 {
+		return r.DialTimeout
+	}
+	return time.Second
+}
+
+type remoteItem struct {
+	id    uint64
+	value interface{}
+}
+
+// remoteSession - одно соединение с воркером. Всё, что было отправлено,
+// но не подтверждено, при обрыве возвращается в очередь.
+type remoteSession struct {
+	conn net.Conn
+	q    *remoteQueue
+
+	mu       sync.Mutex
+	inflight map[uint64]remoteItem
+	err      error
+}
+
+func (s *remoteSession) run(out chan interface{}) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.receive(out)
+	}()
+
+	for {
+		item, ok := s.q.pop()
+		if !ok {
+			s.fail(nil)
+			break
+		}
+		if !s.send(item) {
+			break
+		}
+	}
+
+	<-done
+	return s.err
+}
+
+func (s *remoteSession) send(item remoteItem) bool {
+	payload, err := encodeValues(item.value)
+	if err != nil {
+		s.q.reject(item.value, "remote: "+err.Error())
+		s.q.ack()
+		return true
+	}
+
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		s.q.requeue(item)
+		return false
+	}
+	s.inflight[item.id] = item
+	s.mu.Unlock()
+
+	if err := writeFrame(s.conn, frame{typ: frameItem, id: item.id, payload: payload}); err != nil {
+		s.fail(err)
+		return false
+	}
+	return true
+}
+
+func (s *remoteSession) receive(out chan interface{}) {
+	fr := newFrameReader(s.conn)
+	for {
+		f, err := fr.read()
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		s.mu.Lock()
+		item, ok := s.inflight[f.id]
+		delete(s.inflight, f.id)
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		switch f.typ {
+		case frameResult:
+			values, err := decodeValues(f.payload)
+			if err != nil {
+				s.q.requeue(item)
+				s.fail(err)
+				return
+			}
+			for _, v := range values {
+				out <- v
+			}
+		case frameError:
+			s.q.reject(item.value, "remote: "+string(f.payload))
+		default:
+			s.q.requeue(item)
+			s.fail(fmt.Errorf("unexpected frame type %d", f.typ))
+			return
+		}
+		s.q.ack()
+	}
+}
+
+var errSessionClosed = errors.New("session closed")
+
+// fail закрывает соединение и возвращает неподтверждённые элементы в очередь.
+// err == nil - штатное завершение.
+func (s *remoteSession) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	if err == nil {
+		err = errSessionClosed
+	}
+	s.err = err
+	s.conn.Close()
+	for id, item := range s.inflight {
+		delete(s.inflight, id)
+		s.q.requeue(item)
+	}
+}
+
+// remoteQueue - общая очередь элементов для всех эндпоинтов.
+// pending считает элементы, на которые ещё не пришёл ответ.
+type remoteQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   []remoteItem
+	closed  bool
+	dead    bool
+	pending sync.WaitGroup
+	reject  func(item interface{}, reason string)
+}
+
+func newRemoteQueue(reject func(item interface{}, reason string)) *remoteQueue {
+	q := &remoteQueue{reject: reject}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *remoteQueue) push(item remoteItem) {
+	q.pending.Add(1)
+	q.requeue(item)
+}
+
+func (q *remoteQueue) requeue(item remoteItem) {
+	q.mu.Lock()
+	if q.dead {
+		q.mu.Unlock()
+		q.reject(item.value, noEndpointsReason)
+		q.pending.Done()
+		return
+	}
+	q.items = append(q.items, item)
+	q.cond.Signal()
+	q.mu.Unlock()
+}
+
+func (q *remoteQueue) pop() (remoteItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return remoteItem{}, false
+	}
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item, true
+}
+
+func (q *remoteQueue) ack() {
+	q.pending.Done()
+}
+
+func (q *remoteQueue) wait() {
+	q.pending.Wait()
+}
+
+// kill вызывается, когда не осталось ни одного живого эндпоинта
+func (q *remoteQueue) kill() {
+	q.mu.Lock()
+	q.dead = true
+	items := q.items
+	q.items = nil
+	q.mu.Unlock()
+
+	// sink может блокироваться, поэтому без блокировки очереди
+	for _, item := range items {
+		q.reject(item.value, noEndpointsReason)
+		q.pending.Done()
+	}
+}
+
+const noEndpointsReason = "remote: no endpoints left"
+
+func (q *remoteQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *remoteQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
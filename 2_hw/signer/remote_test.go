@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fastSigners подменяет DataSignerCrc32 и DataSignerMd5 на версии с той же логикой,
+// но с задержкой delay вместо 1 секунды
+func fastSigners(t *testing.T, delay time.Duration) {
+	crc32Signer, md5Signer := DataSignerCrc32, DataSignerMd5
+	t.Cleanup(func() {
+		DataSignerCrc32, DataSignerMd5 = crc32Signer, md5Signer
+	})
+
+	DataSignerMd5 = func(data string) string {
+		data += DataSignerSalt
+		time.Sleep(delay)
+		return fmt.Sprintf("%x", md5.Sum([]byte(data)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		data += DataSignerSalt
+		time.Sleep(delay)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+	}
+}
+
+func intSource(n int) job {
+	return func(in, out chan interface{}) {
+		for i := 0; i < n; i++ {
+			out <- i
+		}
+	}
+}
+
+func collectResult(result *string) job {
+	return func(in, out chan interface{}) {
+		for data := range in {
+			*result = data.(string)
+		}
+	}
+}
+
+func startWorker(t *testing.T, e Endpoint) *Worker {
+	l, err := e.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(DefaultSigner)
+	go w.Serve(l)
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func localEndpoint(t *testing.T) Endpoint {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return Endpoint{Network: "tcp", Address: l.Addr().String()}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	cases := map[string]Endpoint{
+		"127.0.0.1:7000":          {Network: "tcp", Address: "127.0.0.1:7000"},
+		"tcp://127.0.0.1:7000":    {Network: "tcp", Address: "127.0.0.1:7000"},
+		"unix:///tmp/signer.sock": {Network: "unix", Address: "/tmp/signer.sock"},
+	}
+	for s, expected := range cases {
+		e, err := ParseEndpoint(s)
+		if err != nil || e != expected {
+			t.Errorf("ParseEndpoint(%q) = %v, %v; expected %v", s, e, err, expected)
+		}
+	}
+	for _, s := range []string{"udp://127.0.0.1:7000", "unix://"} {
+		if _, err := ParseEndpoint(s); err == nil {
+			t.Errorf("ParseEndpoint(%q): expected error", s)
+		}
+	}
+}
+
+func TestRemoteStages(t *testing.T) {
+	fastSigners(t, 5*time.Millisecond)
+	const n = 20
+
+	var expected string
+	ExecutePipeline(intSource(n), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&expected))
+
+	tcp1, tcp2 := localEndpoint(t), localEndpoint(t)
+	unix := Endpoint{Network: "unix", Address: filepath.Join(t.TempDir(), "worker.sock")}
+	for _, e := range []Endpoint{tcp1, tcp2, unix} {
+		startWorker(t, e)
+	}
+
+	single := &RemoteStage{Stage: "SingleHash", Endpoints: []Endpoint{tcp1, tcp2}}
+	multi := &RemoteStage{Stage: "MultiHash", Endpoints: []Endpoint{unix}}
+	var result string
+	ExecutePipeline(intSource(n), job(single.Run), job(multi.Run), job(CombineResults), collectResult(&result))
+
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+// TestRemoteDeadLetters - элемент, который стадия на воркере отбраковала,
+// попадает в DeadLetters координатора, а не пропадает
+func TestRemoteDeadLetters(t *testing.T) {
+	fastSigners(t, 0)
+	e := localEndpoint(t)
+	startWorker(t, e)
+
+	dead := &DeadLetterQueue{}
+	remote := &RemoteStage{Stage: "MultiHash", Endpoints: []Endpoint{e}, DeadLetters: dead}
+	source := func(in, out chan interface{}) {
+		out <- 7
+		out <- "step1"
+	}
+	var results []string
+	ExecutePipeline(job(source), job(remote.Run), job(func(in, out chan interface{}) {
+		for v := range in {
+			results = append(results, v.(string))
+		}
+	}))
+
+	if len(results) != 1 {
+		t.Errorf("expected 1 result, got %v", results)
+	}
+	items := dead.Items()
+	if len(items) != 1 || items[0].Stage != "MultiHash" || items[0].Item != 7 ||
+		items[0].Reason != "remote: unsupported type int, expected string" {
+		t.Errorf("unexpected dead letters %v", items)
+	}
+}
+
+func TestRemoteStageReconnect(t *testing.T) {
+	fastSigners(t, 20*time.Millisecond)
+	const n = 20
+
+	var expected string
+	ExecutePipeline(intSource(n), job(SingleHash), job(CombineResults), collectResult(&expected))
+
+	e := localEndpoint(t)
+	w := startWorker(t, e)
+
+	source := func(in, out chan interface{}) {
+		for i := 0; i < n; i++ {
+			if i == n/2 {
+				// рвём соединение, пока часть элементов ещё считается на воркере
+				time.Sleep(30 * time.Millisecond)
+				w.Close()
+				startWorker(t, e)
+			}
+			out <- i
+		}
+	}
+	remote := &RemoteStage{Stage: "SingleHash", Endpoints: []Endpoint{e}, MaxRetries: 20, Backoff: 10 * time.Millisecond}
+	var result string
+	ExecutePipeline(job(source), job(remote.Run), job(CombineResults), collectResult(&result))
+
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestRemoteStageUnknownStage(t *testing.T) {
+	e := localEndpoint(t)
+	startWorker(t, e)
+
+	remote := &RemoteStage{Stage: "CombineResults", Endpoints: []Endpoint{e}, MaxRetries: 2, Backoff: time.Millisecond}
+	var count int
+	ExecutePipeline(intSource(3), job(remote.Run), job(func(in, out chan interface{}) {
+		for range in {
+			count++
+		}
+	}))
+
+	if count != 0 {
+		t.Errorf("expected no results from rejected stage, got %d", count)
+	}
+}
+
+// brokenWriteConn читает как обычно, но не может писать после первых writes кадров
+type brokenWriteConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *brokenWriteConn) Write(p []byte) (int, error) {
+	if c.writes == 0 {
+		return 0, errors.New("broken pipe")
+	}
+	c.writes--
+	return c.Conn.Write(p)
+}
+
+// TestWorkerWriteError - воркер закрывает соединение и возвращает ошибку записи,
+// а не продолжает читать элементы, ответы на которые не уходят
+func TestWorkerWriteError(t *testing.T) {
+	fastSigners(t, 0)
+	client, server := net.Pipe()
+	defer client.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- NewWorker(newSigner(DefaultConfig)).serveConn(&brokenWriteConn{Conn: server, writes: 1})
+	}()
+
+	fr := newFrameReader(client)
+	if err := writeFrame(client, frame{typ: frameHello, payload: []byte("SingleHash")}); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := fr.read(); err != nil || f.typ != frameHello {
+		t.Fatalf("hello: %+v, %v", f, err)
+	}
+	payload, err := encodeValues(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// воркер закрывает соединение после первого неотправленного ответа
+	for id := uint64(1); id <= 1000; id++ {
+		if err := writeFrame(client, frame{typ: frameItem, id: id, payload: payload}); err != nil {
+			break
+		}
+	}
+
+	select {
+	case err := <-served:
+		if err == nil || err.Error() != "broken pipe" {
+			t.Errorf("expected write error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker kept serving a connection it cannot write to")
+	}
+}
+
+// TestWorkerProcess запускает воркер отдельным процессом (тестовый бинарник
+// перезапускается в режиме TestHelperWorkerProcess) и гоняет через него пайплайн
+func TestWorkerProcess(t *testing.T) {
+	fastSigners(t, 0)
+	e := Endpoint{Network: "unix", Address: filepath.Join(t.TempDir(), "worker.sock")}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperWorkerProcess$")
+	cmd.Env = append(os.Environ(), "SIGNER_WORKER_LISTEN="+e.String())
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	var expected string
+	ExecutePipeline(intSource(5), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&expected))
+
+	single := &RemoteStage{Stage: "SingleHash", Endpoints: []Endpoint{e}, MaxRetries: 50}
+	multi := &RemoteStage{Stage: "MultiHash", Endpoints: []Endpoint{e}, MaxRetries: 50}
+	var result string
+	ExecutePipeline(intSource(5), job(single.Run), job(multi.Run), job(CombineResults), collectResult(&result))
+
+	if result != expected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, expected)
+	}
+}
+
+func TestHelperWorkerProcess(t *testing.T) {
+	listen := os.Getenv("SIGNER_WORKER_LISTEN")
+	if listen == "" {
+		t.Skip("helper process for TestWorkerProcess")
+	}
+	fastSigners(t, 0)
+	if err := runWorker([]string{"-listen", listen}); err != nil {
+		t.Fatal(err)
+	}
+}
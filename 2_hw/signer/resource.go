@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Resource - общий ресурс с ограниченной ёмкостью (например, DataSignerMd5, который
+// перегревается при параллельных вызовах). Ждущие получают его строго в порядке очереди;
+// если задан limiter, то после получения слота дополнительно ждут токен.
+type Resource struct {
+	mu       sync.Mutex
+	capacity int
+	inUse    int
+	waiters  []chan struct{}
+	reserved int // слоты, взятые Reserve и ещё не переданные Acquire
+	limiter  *TokenBucket
+	stats    ResourceStats
+}
+
+type ResourceStats struct {
+	Acquired  int64         // успешные захваты
+	Waited    int64         // из них пришлось ждать
+	Cancelled int64         // ожидание прервано контекстом
+	TotalWait time.Duration // суммарное время успешных захватов
+	MaxWait   time.Duration
+}
+
+func (s ResourceStats) AvgWait() time.Duration {
+	if s.Acquired == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Acquired)
+}
+
+func NewResource(capacity int, limiter *TokenBucket) *Resource {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Resource{capacity: capacity, limiter: limiter}
+}
+
+func (r *Resource) Acquire(ctx context.Context) error {
+	r.mu.Lock()
+	if r.reserved > 0 {
+		r.reserved--
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+	return r.acquire(ctx)
+}
+
+func (r *Resource) acquire(ctx context.Context) error {
+	start := SignerClock.Now()
+	queued, err := r.acquireSlot(ctx)
+	if err != nil {
+		r.record(false, 0, err)
+		return err
+	}
+	if r.limiter != nil {
+		delay, err := r.limiter.wait(ctx)
+		if err != nil {
+			r.Release()
+			r.record(false, 0, err)
+			return err
+		}
+		queued = queued || delay > 0
+	}
+	r.record(queued, SignerClock.Now().Sub(start), nil)
+	return nil
+}
+
+// Reserve - Acquire для того, кто сам ресурс не использует, а вызывает функцию,
+// которая может его взять: DataSignerMd5 из common.go берёт Md5Resource через
+// OverheatLock, подменённая в тесте - нет. Ближайший Acquire забирает
+// зарезервированный слот без очереди и без повторного учёта в Stats; если
+// его никто не забрал, слот освобождает Unreserve.
+func (r *Resource) Reserve(ctx context.Context) error {
+	if err := r.acquire(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.reserved++
+	r.mu.Unlock()
+	return nil
+}
+
+// Unreserve освобождает слот Reserve, если его не забрал Acquire
+func (r *Resource) Unreserve() {
+	r.mu.Lock()
+	if r.reserved == 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.reserved--
+	r.mu.Unlock()
+	r.Release()
+}
+
+func (r *Resource) acquireSlot(ctx context.Context) (queued bool, err error) {
+	r.mu.Lock()
+	if r.inUse < r.capacity && len(r.waiters) == 0 {
+		r.inUse++
+		r.mu.Unlock()
+		return false, nil
+	}
+	ready := make(chan struct{})
+	r.waiters = append(r.waiters, ready)
+	r.mu.Unlock()
+
+	select {
+	case <-ready:
+		return true, nil
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	select {
+	case <-ready:
+		// слот успели передать, пока мы отменялись - отдаём его следующему
+		r.mu.Unlock()
+		r.Release()
+		return true, ctx.Err()
+	default:
+	}
+	for i, w := range r.waiters {
+		if w == ready {
+			r.waiters = append(r.waiters[:i], r.waiters[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	return true, ctx.Err()
+}
+
+// Release передаёт слот первому в очереди, не уменьшая inUse,
+// чтобы его не перехватил новый Acquire
+func (r *Resource) Release() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.waiters) > 0 {
+		ready := r.waiters[0]
+		r.waiters = r.waiters[1:]
+		close(ready)
+		return
+	}
+	if r.inUse == 0 {
+		panic("resource: release without acquire")
+	}
+	r.inUse--
+}
+
+func (r *Resource) record(queued bool, wait time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.stats.Cancelled++
+		return
+	}
+	r.stats.Acquired++
+	if queued {
+		r.stats.Waited++
+	}
+	r.stats.TotalWait += wait
+	if wait > r.stats.MaxWait {
+		r.stats.MaxWait = wait
+	}
+}
+
+func (r *Resource) Stats() ResourceStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// TokenBucket выдаёт не больше rate токенов в секунду с запасом burst.
+// Токены резервируются в порядке вызова Wait, поэтому ожидание тоже честное.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: SignerClock.Now()}
+}
+
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	_, err := b.wait(ctx)
+	return err
+}
+
+func (b *TokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	b.mu.Lock()
+	now := SignerClock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait == 0 {
+		return 0, nil
+	}
+	timer, stop := SignerClock.Timer(wait)
+	select {
+	case <-timer:
+		return wait, nil
+	case <-ctx.Done():
+		stop()
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
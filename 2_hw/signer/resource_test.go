@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResourceCapacity(t *testing.T) {
+	r := NewResource(2, nil)
+	var mu sync.Mutex
+	var inUse, maxInUse int
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Acquire(context.Background())
+			mu.Lock()
+			if inUse++; inUse > maxInUse {
+				maxInUse = inUse
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			inUse--
+			mu.Unlock()
+			r.Release()
+		}()
+	}
+	wg.Wait()
+
+	if maxInUse != 2 {
+		t.Errorf("expected at most 2 concurrent holders, got %d", maxInUse)
+	}
+	stats := r.Stats()
+	if stats.Acquired != 10 || stats.Waited == 0 || stats.MaxWait == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResourceFIFO(t *testing.T) {
+	r := NewResource(1, nil)
+	r.Acquire(context.Background())
+
+	var order []int
+	var mu sync.Mutex
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.Acquire(context.Background())
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			r.Release()
+		}(i)
+		// ждём, пока горутина встанет в очередь
+		for waiting(r) != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	r.Release()
+	wg.Wait()
+
+	if !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("waiters served out of order: %v", order)
+	}
+}
+
+func waiting(r *Resource) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.waiters)
+}
+
+func TestResourceCancel(t *testing.T) {
+	r := NewResource(1, nil)
+	r.Acquire(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if waiting(r) != 0 {
+		t.Errorf("cancelled waiter left in queue")
+	}
+
+	r.Release()
+	if err := r.Acquire(context.Background()); err != nil {
+		t.Errorf("resource must be free after release: %v", err)
+	}
+	if stats := r.Stats(); stats.Cancelled != 1 || stats.Acquired != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(100, 1) // 1 токен в 10ms
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Errorf("6 tokens at 100/s taken in %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Wait(ctx); err != context.Canceled {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestMd5ResourceNoOverheat(t *testing.T) {
+	md5Resource, lock, unlock := Md5Resource, OverheatLock, OverheatUnlock
+	defer func() {
+		Md5Resource, OverheatLock, OverheatUnlock = md5Resource, lock, unlock
+	}()
+	// TestSigner подменяет OverheatLock, возвращаем реализацию из common.go
+	Md5Resource = NewResource(1, NewTokenBucket(200, 1))
+	OverheatLock, OverheatUnlock = commonOverheatLock, commonOverheatUnlock
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			DataSignerMd5("data")
+		}()
+	}
+	wg.Wait()
+
+	stats := Md5Resource.Stats()
+	if stats.Acquired != 5 || stats.Waited < 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.MaxWait > time.Second {
+		t.Errorf("md5 waited too long: %s", stats.MaxWait)
+	}
+}
+
+func TestResourceReserve(t *testing.T) {
+	r := NewResource(1, nil)
+	ctx := context.Background()
+
+	// Acquire забирает зарезервированный слот, Unreserve после этого ничего не делает
+	if err := r.Reserve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r.Release()
+	r.Unreserve()
+
+	// незабранный слот освобождает Unreserve
+	if err := r.Reserve(ctx); err != nil {
+		t.Fatal(err)
+	}
+	r.Unreserve()
+	timeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := r.acquire(timeout); err != nil {
+		t.Fatalf("slot not released: %v", err)
+	}
+	r.Release()
+
+	if stats := r.Stats(); stats.Acquired != 3 || stats.Waited != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+// TestMd5ResourcePipeline - пайплайн ждёт DataSignerMd5 через Md5Resource: его
+// ёмкость действует, ожидания попадают в Stats, а подмена DataSignerMd5 вызывается
+// и с Signer.Context, и без
+func TestMd5ResourcePipeline(t *testing.T) {
+	fastSigners(t, 0)
+	md5Resource, lock, unlock := Md5Resource, OverheatLock, OverheatUnlock
+	defer func() {
+		Md5Resource, OverheatLock, OverheatUnlock = md5Resource, lock, unlock
+	}()
+	OverheatLock, OverheatUnlock = commonOverheatLock, commonOverheatUnlock
+
+	mu := &sync.Mutex{}
+	var calls, running, maxRunning int
+	DataSignerMd5 = func(data string) string {
+		OverheatLock()
+		defer OverheatUnlock()
+		mu.Lock()
+		calls++
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}()
+		// md5Sign, а не commonDataSignerMd5: тот снова взял бы Md5Resource
+		return md5Sign(data)
+	}
+
+	const items = 6
+	for _, capacity := range []int{1, 2} {
+		for _, ctx := range []context.Context{nil, context.Background()} {
+			Md5Resource = NewResource(capacity, nil)
+			calls, maxRunning = 0, 0
+			s := newSigner(DefaultConfig)
+			s.Context = ctx
+			ExecutePipeline(intSource(items), job(s.SingleHash), job(func(in, out chan interface{}) {
+				for range in {
+				}
+			}))
+
+			stats := Md5Resource.Stats()
+			if calls != items || stats.Acquired != items || stats.Waited == 0 || maxRunning != capacity {
+				t.Errorf("capacity %d, context %v: %d calls, %d at once, stats %+v", capacity, ctx != nil, calls, maxRunning, stats)
+			}
+		}
+	}
+}
+
+// heldMd5Resource подменяет Md5Resource занятым ресурсом, release его освобождает
+func heldMd5Resource(t *testing.T) (release func()) {
+	md5Resource := Md5Resource
+	t.Cleanup(func() { Md5Resource = md5Resource })
+	Md5Resource = NewResource(1, nil)
+	if err := Md5Resource.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return Md5Resource.Release
+}
+
+func TestDataSignerMd5Context(t *testing.T) {
+	release := heldMd5Resource(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := DataSignerMd5Context(ctx, "data"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+
+	release()
+	got, err := DataSignerMd5Context(context.Background(), "data")
+	if err != nil || got != commonDataSignerMd5("data") {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+// TestSignerContext - отмена Signer.Context прерывает ожидание md5, элементы
+// уходят в DeadLetters, а ошибка не остаётся в кеше
+func TestSignerContext(t *testing.T) {
+	fastSigners(t, 0)
+	release := heldMd5Resource(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newSigner(DefaultConfig)
+	s.Context = ctx
+	s.Cache = NewMemo(10)
+	dead := &DeadLetterQueue{}
+	s.DeadLetters = dead
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	var results []string
+	ExecutePipeline(intSource(2), job(s.SingleHash), job(func(in, out chan interface{}) {
+		for v := range in {
+			results = append(results, v.(string))
+		}
+	}))
+
+	if len(results) != 0 || dead.Len() != 2 {
+		t.Fatalf("got results %v, dead letters %v", results, dead.Items())
+	}
+	for _, d := range dead.Items() {
+		if d.Stage != "SingleHash" || d.Reason != context.Canceled.Error() {
+			t.Errorf("unexpected dead letter %s", d)
+		}
+	}
+
+	release()
+	s.Context = context.Background()
+	got, err := s.sign(Md5, "0")
+	if err != nil || got != commonDataSignerMd5("0") {
+		t.Errorf("after cancel: got %q, %v", got, err)
+	}
+}
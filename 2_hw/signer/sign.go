@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+const (
+	modeCombine = "combine" // SingleHash -> MultiHash -> CombineResults, одна строка результата
+	modeLines   = "lines"   // результат для каждой входной строки
+
+	formatText = "text"
+	formatJSON = "json"
+)
+
+type signedLine struct {
+	Line   int    `json:"line"` // номер записи во входных данных, с 1
+	Input  string `json:"input"`
+	Result string `json:"result"`
+}
+
+// runSign читает непустые строки из файлов (или stdin, если файлов нет или указан "-")
+// и подписывает их через пайплайн; с -v шаги подписи пишутся в stderr
+func runSign(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("sign", flag.ContinueOnError)
+	salt := fs.String("salt", "", "DataSignerSalt")
+	concurrency := fs.Int("concurrency", 0, "max items hashed at once per stage, 0 - unlimited")
+	format := fs.String("format", formatText, "output format: text or json")
+	mode := fs.String("mode", modeCombine, "combine - one combined result, lines - result per input line")
+	verbose := fs.Bool("v", false, "log every hashing step to stderr")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != formatText && *format != formatJSON {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *mode != modeCombine && *mode != modeLines {
+		return fmt.Errorf("unknown mode %q", *mode)
+	}
+
+	inputs, err := openInputs(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	defer closeInputs(inputs)
+
+	cfg := DefaultConfig
+	cfg.Salt = *salt
+	cfg.Log = log.New(io.Discard, "", 0)
+	if *verbose {
+		cfg.Log = log.New(stderr, "", log.LstdFlags)
+	}
+	s := newSigner(cfg)
+	s.Concurrency = *concurrency
+
+	var readErr error
+	source := func(in, out chan interface{}) {
+		readErr = readRecords(inputs, func(n int, text string) {
+			if *mode == modeLines {
+				out <- signedLine{Line: n, Input: text}
+			} else {
+				out <- text
+			}
+		})
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+	var writeErr error
+	write := func(v interface{}, text string) {
+		if writeErr != nil {
+			return
+		}
+		if *format == formatJSON {
+			writeErr = json.NewEncoder(w).Encode(v)
+			return
+		}
+		_, writeErr = fmt.Fprintln(w, text)
+	}
+
+	if *mode == modeCombine {
+		ExecutePipeline(job(source), job(s.SingleHash), job(s.MultiHash), job(s.CombineResults),
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					result := v.(string)
+					write(map[string]string{"result": result}, result)
+				}
+			}))
+	} else {
+		ExecutePipeline(job(source), job(s.signLines),
+			job(func(in, out chan interface{}) {
+				for v := range in {
+					line := v.(signedLine)
+					write(line, strconv.Itoa(line.Line)+"\t"+line.Input+"\t"+line.Result)
+				}
+			}))
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return w.Flush()
+}
+
+func openInputs(paths []string, stdin io.Reader) ([]io.Reader, error) {
+	if len(paths) == 0 {
+		return []io.Reader{stdin}, nil
+	}
+
+	inputs := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		if path == "-" {
+			inputs = append(inputs, stdin)
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			closeInputs(inputs)
+			return nil, err
+		}
+		inputs = append(inputs, f)
+	}
+	return inputs, nil
+}
+
+func closeInputs(inputs []io.Reader) {
+	for _, r := range inputs {
+		if f, ok := r.(*os.File); ok && f != os.Stdin {
+			f.Close()
+		}
+	}
+}
+
+func readRecords(inputs []io.Reader, emit func(line int, text string)) error {
+	line := 0
+	for _, r := range inputs {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			line++
+			emit(line, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signLines считает SingleHash и MultiHash для каждой строки отдельно,
+// сохраняя связь результата со входом
+func (s *Signer) signLines(in, out chan interface{}) {
+	done := make(chan struct{})
+	slots := s.slots()
+
+	var count int
+	for inData := range in {
+		line, ok := inData.(signedLine)
+		if !ok {
+			s.reject("signLines", inData, fmt.Sprintf("unsupported type %T, expected signedLine", inData))
+			continue
+		}
+
+		count++
+		slots.acquire()
+		go func(line signedLine) {
+			step1, err := s.checkpointed("SingleHash", line.Input, s.singleHash)
+			if err == nil {
+				line.Result, err = s.checkpointed("MultiHash", step1, s.multiHash)
+			}
+			if err != nil {
+				s.reject("signLines", line, err.Error())
+			} else {
+				out <- line
+			}
+			slots.release()
+			done <- struct{}{}
+		}(line)
+	}
+
+	for i := 0; i < count; i++ {
+		<-done
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSignCombine(t *testing.T) {
+	fastSigners(t, 0)
+
+	var expected string
+	ExecutePipeline(intSource(3), job(SingleHash), job(MultiHash), job(CombineResults), collectResult(&expected))
+
+	out := new(bytes.Buffer)
+	if err := runSign([]string{"-concurrency", "2"}, strings.NewReader("0\n1\n\n2\n"), out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected+"\n" {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := runSign([]string{"-format", "json"}, strings.NewReader("0\n1\n2\n"), out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var result map[string]string
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil || result["result"] != expected {
+		t.Errorf("bad json output %q: %v", out.String(), err)
+	}
+}
+
+func TestSignLines(t *testing.T) {
+	fastSigners(t, 0)
+	logOutput := log.Writer()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "input.txt")
+	os.WriteFile(path, []byte("hello\nworld\n"), 0o644)
+
+	out := new(bytes.Buffer)
+	args := []string{"-mode", "lines", "-format", "json", "-salt", "x", path, "-"}
+	if err := runSign(args, strings.NewReader("again\n"), out, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// соль и логгер - в Config, глобальное состояние не трогается
+	if DataSignerSalt != "" || log.Writer() != logOutput {
+		t.Errorf("runSign changed globals: salt %q, log output %v", DataSignerSalt, log.Writer())
+	}
+
+	var lines []signedLine
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var line signedLine
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+
+	inputs := []string{"hello", "world", "again"}
+	if len(lines) != len(inputs) {
+		t.Fatalf("expected %d lines, got %v", len(inputs), lines)
+	}
+	cfg := DefaultConfig
+	cfg.Salt = "x"
+	s := newSigner(cfg)
+	for i, line := range lines {
+		step1, err := s.singleHash(inputs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := s.multiHash(step1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line.Line != i+1 || line.Input != inputs[i] || line.Result != expected {
+			t.Errorf("got %+v, expected result %s for %q", line, expected, inputs[i])
+		}
+	}
+}
+
+func TestSignBadArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"-format", "xml"},
+		{"-mode", "tree"},
+		{filepath.Join(t.TempDir(), "missing.txt")},
+	} {
+		if err := runSign(args, strings.NewReader(""), new(bytes.Buffer), io.Discard); err == nil {
+			t.Errorf("runSign(%v): expected error", args)
+		}
+	}
+}
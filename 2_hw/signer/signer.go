@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,15 +14,11 @@ func ExecutePipeline(jobs ...job) {
 		return
 	}
 
+	// у источника входа нет, закрытый канал не держит его горутину
 	in := make(chan interface{})
+	close(in)
 	for _, j := range jobs {
-		out := make(chan interface{})
-		go func(j job, in, out chan interface{}) {
-			defer close(out)
-			j(in, out)
-		}(j, in, out)
-
-		in = out // in2=out1
+		in = startJob(j, in) // in2=out1
 	}
 
 	for range in {
@@ -30,16 +26,33 @@ func ExecutePipeline(jobs ...job) {
 }
 
 func SingleHash(in, out chan interface{}) {
-	sema := make(chan struct{}, 1)
+	DefaultSigner.SingleHash(in, out)
+}
+
+// SingleHash принимает числа (как в задании) и строки (например, строки из файла)
+func (s *Signer) SingleHash(in, out chan interface{}) {
 	done := make(chan struct{})
+	slots := s.slots()
 
 	var count int
 	for inData := range in {
+		data, ok := singleHashData(inData)
+		if !ok {
+			s.reject("SingleHash", inData, fmt.Sprintf("unsupported type %T, expected int or string", inData))
+			continue
+		}
+
 		count++
-		go func(inData interface{}) {
-			out <- singleHash(sema, strconv.Itoa(inData.(int)))
+		slots.acquire()
+		go func(inData interface{}, data string) {
+			if result, err := s.checkpointed("SingleHash", data, s.singleHash); err != nil {
+				s.reject("SingleHash", inData, err.Error())
+			} else {
+				out <- result
+			}
+			slots.release()
 			done <- struct{}{}
-		}(inData)
+		}(inData, data)
 	}
 
 	for i := 0; i < count; i++ {
@@ -47,48 +60,85 @@ func SingleHash(in, out chan interface{}) {
 	}
 }
 
-func singleHash(sema chan struct{}, data string) string {
-	log.Printf("%s SingleHash data %s\n", data, data)
-	md5Ch := make(chan string)
-	go func() {
-		sema <- struct{}{}
-		md5Ch <- DataSignerMd5(data)
-		<-sema
-	}()
+func singleHashData(inData interface{}) (string, bool) {
+	switch data := inData.(type) {
+	case string:
+		return data, true
+	case int:
+		return strconv.Itoa(data), true
+	}
+	return "", false
+}
+
+func (s *Signer) singleHash(data string) (string, error) {
+	outer, inner := s.cfg.Outer, s.cfg.Inner
+	s.logf("%s SingleHash data %s\n", data, data)
 
-	crc32Ch := make(chan string)
+	var outerData string
+	outerErr := make(chan error)
 	go func() {
-		crc32Data := DataSignerCrc32(data)
-		log.Printf("%s SingleHash crc32(data) %s\n", data, crc32Data)
-		crc32Ch <- crc32Data
+		var err error
+		if outerData, err = s.sign(outer, data); err == nil {
+			s.logf("%s SingleHash %s(data) %s\n", data, outer, outerData)
+		}
+		outerErr <- err
 	}()
 
-	crc32Md5Ch := make(chan string)
+	var outerInnerData string
+	outerInnerErr := make(chan error)
 	go func() {
-		md5Data := <-md5Ch
-		log.Printf("%s SingleHash md5(data) %s\n", data, md5Data)
-		crc32Md5Data := DataSignerCrc32(md5Data)
-		log.Printf("%s SingleHash crc32(md5(data)) %s\n", data, crc32Md5Data)
-		crc32Md5Ch <- crc32Md5Data
+		innerData, err := s.sign(inner, data)
+		if err != nil {
+			outerInnerErr <- err
+			return
+		}
+		s.logf("%s SingleHash %s(data) %s\n", data, inner, innerData)
+		if outerInnerData, err = s.sign(outer, innerData); err == nil {
+			s.logf("%s SingleHash %s(%s(data)) %s\n", data, outer, inner, outerInnerData)
+		}
+		outerInnerErr <- err
 	}()
 
-	crc32Data := <-crc32Ch
-	crc32Md5Data := <-crc32Md5Ch
-	result := crc32Data + "~" + crc32Md5Data
-	log.Printf("%s SingleHash result %s\n", data, result)
-	return result
+	err1, err2 := <-outerErr, <-outerInnerErr
+	if err1 != nil {
+		return "", err1
+	}
+	if err2 != nil {
+		return "", err2
+	}
+	result := outerData + "~" + outerInnerData
+	s.logf("%s SingleHash result %s\n", data, result)
+	return result, nil
 }
 
 func MultiHash(in, out chan interface{}) {
+	DefaultSigner.MultiHash(in, out)
+}
+
+func (s *Signer) MultiHash(in, out chan interface{}) {
 	done := make(chan struct{})
 
+	slots := s.slots()
+
 	var count int
 	for inData := range in {
+		data, ok := inData.(string)
+		if !ok {
+			s.reject("MultiHash", inData, fmt.Sprintf("unsupported type %T, expected string", inData))
+			continue
+		}
+
 		count++
-		go func(inData interface{}) {
-			out <- multiHash(inData.(string))
+		slots.acquire()
+		go func(data string) {
+			if result, err := s.checkpointed("MultiHash", data, s.multiHash); err != nil {
+				s.reject("MultiHash", data, err.Error())
+			} else {
+				out <- result
+			}
+			slots.release()
 			done <- struct{}{}
-		}(inData)
+		}(data)
 	}
 
 	for i := 0; i < count; i++ {
@@ -96,17 +146,21 @@ func MultiHash(in, out chan interface{}) {
 	}
 }
 
-func multiHash(data string) string {
-	const thCount int = 6
+func (s *Signer) multiHash(data string) (string, error) {
+	thCount := s.cfg.MultiCount
 	resultSlice := make([]string, thCount)
+	errs := make([]error, thCount)
 	done := make(chan struct{})
 
 	for i := 0; i < thCount; i++ {
 		go func(i int) {
 			th := strconv.Itoa(i)
-			crc32ThData := DataSignerCrc32(th + data)
-			resultSlice[i] = crc32ThData
-			log.Printf("%s MultiHash crc32(th+step1): %s %s\n", data, th, crc32ThData)
+			thData, err := s.sign(s.cfg.Multi, th+data)
+			if err == nil {
+				resultSlice[i] = thData
+				s.logf("%s MultiHash %s(th+step1): %s %s\n", data, s.cfg.Multi, th, thData)
+			}
+			errs[i] = err
 			done <- struct{}{}
 		}(i)
 	}
@@ -114,20 +168,34 @@ func multiHash(data string) string {
 	for i := 0; i < thCount; i++ {
 		<-done
 	}
+	for _, err := range errs {
+		if err != nil {
+			return "", err
+		}
+	}
 
 	result := strings.Join(resultSlice, "")
-	log.Printf("%s MultiHash result: %s\n", data, result)
-	return result
+	s.logf("%s MultiHash result: %s\n", data, result)
+	return result, nil
 }
 
 func CombineResults(in, out chan interface{}) {
+	DefaultSigner.CombineResults(in, out)
+}
+
+func (s *Signer) CombineResults(in, out chan interface{}) {
 	dataList := make([]string, 0)
 	for dataIface := range in {
-		dataList = append(dataList, dataIface.(string))
+		data, ok := dataIface.(string)
+		if !ok {
+			s.reject("CombineResults", dataIface, fmt.Sprintf("unsupported type %T, expected string", dataIface))
+			continue
+		}
+		dataList = append(dataList, data)
 	}
 
 	sort.Strings(dataList)
 	result := strings.Join(dataList, "_")
-	log.Printf("CombineResults\nresult: %s\n", result)
+	s.logf("CombineResults\nresult: %s\n", result)
 	out <- result
 }
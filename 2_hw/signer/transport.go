@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// frame: | len uint32 | type byte | id uint64 | payload |, len = 1 + 8 + len(payload)
+// value: | kind byte | len uint32 | data |
+
+type frameType byte
+
+const (
+	frameHello  frameType = iota + 1 // coordinator -> worker: stage name; worker -> coordinator: ack
+	frameItem                        // coordinator -> worker: one value
+	frameResult                      // worker -> coordinator: all values the stage emitted for the item
+	frameError                       // worker -> coordinator: error message
+)
+
+const (
+	kindInt byte = iota + 1
+	kindString
+)
+
+const (
+	frameHeaderLen = 1 + 8
+	maxFrameLen    = 16 << 20
+)
+
+var errFrameTooLarge = errors.New("frame too large")
+
+type frame struct {
+	typ     frameType
+	id      uint64
+	payload []byte
+}
+
+type frameReader struct {
+	r *bufio.Reader
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{r: bufio.NewReader(r)}
+}
+
+func (fr *frameReader) read() (frame, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(fr.r, lenBuf[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n < frameHeaderLen {
+		return frame{}, fmt.Errorf("frame too short: %d", n)
+	}
+	if n > maxFrameLen {
+		return frame{}, errFrameTooLarge
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(fr.r, buf); err != nil {
+		return frame{}, err
+	}
+	return frame{
+		typ:     frameType(buf[0]),
+		id:      binary.BigEndian.Uint64(buf[1:frameHeaderLen]),
+		payload: buf[frameHeaderLen:],
+	}, nil
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	n := frameHeaderLen + len(f.payload)
+	if n > maxFrameLen {
+		return errFrameTooLarge
+	}
+
+	buf := make([]byte, 4+n)
+	binary.BigEndian.PutUint32(buf, uint32(n))
+	buf[4] = byte(f.typ)
+	binary.BigEndian.PutUint64(buf[5:], f.id)
+	copy(buf[4+frameHeaderLen:], f.payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendValue(buf []byte, v interface{}) ([]byte, error) {
+	var kind byte
+	var data []byte
+	switch v := v.(type) {
+	case int:
+		kind = kindInt
+		data = make([]byte, 8)
+		binary.BigEndian.PutUint64(data, uint64(v))
+	case string:
+		kind = kindString
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+
+	var header [5]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	buf = append(buf, header[:]...)
+	return append(buf, data...), nil
+}
+
+func encodeValues(values ...interface{}) ([]byte, error) {
+	var buf []byte
+	var err error
+	for _, v := range values {
+		if buf, err = appendValue(buf, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func decodeValues(buf []byte) ([]interface{}, error) {
+	values := make([]interface{}, 0, 1)
+	for len(buf) > 0 {
+		if len(buf) < 5 {
+			return nil, errors.New("truncated value header")
+		}
+		kind := buf[0]
+		n := binary.BigEndian.Uint32(buf[1:5])
+		buf = buf[5:]
+		if uint32(len(buf)) < n {
+			return nil, errors.New("truncated value")
+		}
+		data := buf[:n]
+		buf = buf[n:]
+
+		switch kind {
+		case kindInt:
+			if n != 8 {
+				return nil, fmt.Errorf("bad int length %d", n)
+			}
+			values = append(values, int(binary.BigEndian.Uint64(data)))
+		case kindString:
+			values = append(values, string(data))
+		default:
+			return nil, fmt.Errorf("unknown value kind %d", kind)
+		}
+	}
+	return values, nil
+}
+
+type Endpoint struct {
+	Network string // tcp или unix
+	Address string
+}
+
+// ParseEndpoint: "tcp://127.0.0.1:7000", "unix:///tmp/signer.sock";
+// без схемы считается tcp
+func ParseEndpoint(s string) (Endpoint, error) {
+	network, addr := "tcp", s
+	if i := strings.Index(s, "://"); i >= 0 {
+		network, addr = s[:i], s[i+3:]
+	}
+	if network != "tcp" && network != "unix" {
+		return Endpoint{}, fmt.Errorf("unsupported network %q", network)
+	}
+	if addr == "" {
+		return Endpoint{}, fmt.Errorf("empty address in %q", s)
+	}
+	return Endpoint{Network: network, Address: addr}, nil
+}
+
+func (e Endpoint) String() string {
+	return e.Network + "://" + e.Address
+}
+
+func (e Endpoint) Listen() (net.Listener, error) {
+	return net.Listen(e.Network, e.Address)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+)
+
+// Worker выполняет поэлементные стадии (SingleHash, MultiHash) для удалённого координатора.
+// Каждый frameItem прогоняется через стадию отдельно, поэтому стадии вроде
+// CombineResults, которым нужен весь поток, удалённо запускать нельзя.
+type Worker struct {
+	Stages map[string]job
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func NewWorker(s *Signer) *Worker {
+	return &Worker{Stages: map[string]job{
+		"SingleHash": workerStage(s, (*Signer).SingleHash),
+		"MultiHash":  workerStage(s, (*Signer).MultiHash),
+	}}
+}
+
+// workerStage запускает стадию на копии s, у которой отбракованные элементы уходят
+// в out как DeadLetter: processItem вернёт за них frameError, и координатор
+// отправит элемент в свои DeadLetters
+func workerStage(s *Signer, stage func(s *Signer, in, out chan interface{})) job {
+	return func(in, out chan interface{}) {
+		item := *s
+		item.DeadLetters = outSink(out)
+		stage(&item, in, out)
+	}
+}
+
+// outSink отправляет отбракованные элементы в выход стадии
+type outSink chan interface{}
+
+func (c outSink) Put(d DeadLetter) {
+	c <- d
+}
+
+var errWorkerClosed = errors.New("worker closed")
+
+func (w *Worker) Serve(l net.Listener) error {
+	if !w.track(l, nil) {
+		l.Close()
+		return errWorkerClosed
+	}
+	defer w.untrack(l, nil)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if w.isClosed() {
+				return errWorkerClosed
+			}
+			return err
+		}
+		if !w.track(nil, conn) {
+			conn.Close()
+			return errWorkerClosed
+		}
+
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer w.untrack(nil, conn)
+			if err := w.serveConn(conn); err != nil {
+				log.Printf("worker %s: %v\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// Close останавливает приём соединений и обрывает текущие
+func (w *Worker) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	for l := range w.listeners {
+		l.Close()
+	}
+	for c := range w.conns {
+		c.Close()
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+	return nil
+}
+
+func (w *Worker) track(l net.Listener, c net.Conn) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	if w.listeners == nil {
+		w.listeners = make(map[net.Listener]struct{})
+		w.conns = make(map[net.Conn]struct{})
+	}
+	if l != nil {
+		w.listeners[l] = struct{}{}
+	}
+	if c != nil {
+		w.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (w *Worker) untrack(l net.Listener, c net.Conn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.listeners, l)
+	delete(w.conns, c)
+}
+
+func (w *Worker) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+func (w *Worker) serveConn(conn net.Conn) error {
+	defer conn.Close()
+	fr := newFrameReader(conn)
+
+	// после первой ошибки записи соединение закрывается: чтение ниже тоже
+	// падает, и serveConn возвращает ошибку записи, а не крутится дальше
+	var writeMu sync.Mutex
+	var writeErr error
+	write := func(f frame) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if writeErr != nil {
+			return writeErr
+		}
+		if writeErr = writeFrame(conn, f); writeErr != nil {
+			conn.Close()
+		}
+		return writeErr
+	}
+	failedWrite := func() error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return writeErr
+	}
+
+	hello, err := fr.read()
+	if err != nil {
+		return err
+	}
+	if hello.typ != frameHello {
+		return fmt.Errorf("expected hello, got frame type %d", hello.typ)
+	}
+	stage, ok := w.Stages[string(hello.payload)]
+	if !ok {
+		err := fmt.Errorf("unknown stage %q", hello.payload)
+		if werr := write(frame{typ: frameError, payload: []byte(err.Error())}); werr != nil {
+			return fmt.Errorf("%v, reporting it: %v", err, werr)
+		}
+		return err
+	}
+	if err := write(frame{typ: frameHello}); err != nil {
+		return err
+	}
+
+	var items sync.WaitGroup
+	defer items.Wait()
+	for {
+		f, err := fr.read()
+		if err != nil {
+			items.Wait()
+			if werr := failedWrite(); werr != nil {
+				return werr
+			}
+			if w.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if f.typ != frameItem {
+			return fmt.Errorf("expected item, got frame type %d", f.typ)
+		}
+
+		items.Add(1)
+		go func(f frame) {
+			defer items.Done()
+			// ошибка записи закрывает соединение, serveConn вернёт её из цикла чтения
+			write(processItem(stage, f))
+		}(f)
+	}
+}
+
+func processItem(stage job, f frame) frame {
+	values, err := decodeValues(f.payload)
+	if err == nil && len(values) != 1 {
+		err = fmt.Errorf("expected 1 value, got %d", len(values))
+	}
+	if err == nil {
+		values, err = runStage(stage, values[0])
+	}
+	for _, v := range values {
+		if d, ok := v.(DeadLetter); ok && err == nil {
+			err = errors.New(d.Reason)
+		}
+	}
+
+	var payload []byte
+	if err == nil {
+		payload, err = encodeValues(values...)
+	}
+	if err != nil {
+		return frame{typ: frameError, id: f.id, payload: []byte(err.Error())}
+	}
+	return frame{typ: frameResult, id: f.id, payload: payload}
+}
+
+// runStage прогоняет через стадию одно значение и собирает всё, что она выдала
+func runStage(stage job, item interface{}) (results []interface{}, err error) {
+	in := make(chan interface{}, 1)
+	in <- item
+	close(in)
+
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("stage panic: %v", r)
+			}
+		}()
+		stage(in, out)
+	}()
+
+	for v := range out {
+		results = append(results, v)
+	}
+	return results, err
+}
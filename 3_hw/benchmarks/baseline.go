@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+)
+
+// baselineVersion - версия формата baseline.json, меняется при несовместимых изменениях
+const baselineVersion = 1
+
+// BenchResult - то же, что печатает go test -bench . -benchmem
+type BenchResult struct {
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+}
+
+// Baseline - результаты бенчмарков и где они сняты: ns/op между машинами не сравнимы
+type Baseline struct {
+	Version    int                    `json:"version"`
+	GoVersion  string                 `json:"go_version"`
+	GOOS       string                 `json:"goos"`
+	GOARCH     string                 `json:"goarch"`
+	CPUs       int                    `json:"cpus"`
+	Benchmarks map[string]BenchResult `json:"benchmarks"`
+}
+
+func NewBaseline() *Baseline {
+	return &Baseline{
+		Version:    baselineVersion,
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		Benchmarks: make(map[string]BenchResult),
+	}
+}
+
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("baseline %s: %v", path, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("baseline %s: version %d, expected %d", path, b.Version, baselineVersion)
+	}
+	return b, nil
+}
+
+// Save пишет baseline с отступами и ключами по алфавиту, чтобы в git был читаемый diff
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// BaselineDiff - результат CompareBaseline
+type BaselineDiff struct {
+	Report      string   // таблица old/new/delta по всем метрикам
+	Regressions []string // "Fast allocs/op: +25.0%"
+	Missing     []string // есть в baseline, но не в current: выпавший бенчмарк - тоже провал
+}
+
+// CompareBaseline сравнивает current с base. Регрессия - метрика выросла больше
+// чем на threshold (0.2 - на 20%). withTime=false не сравнивает ns/op; с withTime
+// baseline, снятый на другой машине (GOOS, GOARCH, число CPU), - ошибка: ns/op
+// у Parallel на 1 и на 8 ядрах различаются в разы.
+func CompareBaseline(base, current *Baseline, threshold float64, withTime bool) (*BaselineDiff, error) {
+	if withTime && (base.GOOS != current.GOOS || base.GOARCH != current.GOARCH || base.CPUs != current.CPUs) {
+		return nil, fmt.Errorf("baseline from %s/%s with %d CPUs, current %s/%s with %d CPUs: ns/op not comparable",
+			base.GOOS, base.GOARCH, base.CPUs, current.GOOS, current.GOARCH, current.CPUs)
+	}
+
+	names := make([]string, 0, len(current.Benchmarks))
+	for name := range current.Benchmarks {
+		names = append(names, name)
+	}
+	for name := range base.Benchmarks {
+		if _, ok := current.Benchmarks[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diff := &BaselineDiff{}
+	buf := new(bytes.Buffer)
+	table := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "benchmark\tmetric\tbaseline\tcurrent\tdelta\t")
+	for _, name := range names {
+		cur, ok := current.Benchmarks[name]
+		if !ok {
+			diff.Missing = append(diff.Missing, name)
+			fmt.Fprintf(table, "%s\t\t\t-\t\tMISSING\n", name)
+			continue
+		}
+		old, ok := base.Benchmarks[name]
+		if !ok {
+			fmt.Fprintf(table, "%s\t\t-\t\t\tnot in baseline\n", name)
+			continue
+		}
+
+		metrics := []struct {
+			name     string
+			old, cur float64
+			compare  bool
+		}{
+			{"ns/op", old.NsPerOp, cur.NsPerOp, withTime},
+			{"B/op", float64(old.BytesPerOp), float64(cur.BytesPerOp), true},
+			{"allocs/op", float64(old.AllocsPerOp), float64(cur.AllocsPerOp), true},
+		}
+		for _, m := range metrics {
+			delta := relativeDelta(m.old, m.cur)
+			status := ""
+			switch {
+			case !m.compare:
+				status = "not compared"
+			case delta > threshold:
+				status = "REGRESSION"
+				diff.Regressions = append(diff.Regressions, fmt.Sprintf("%s %s: %s", name, m.name, formatDelta(delta)))
+			}
+			fmt.Fprintf(table, "%s\t%s\t%.0f\t%.0f\t%s\t%s\n", name, m.name, m.old, m.cur, formatDelta(delta), status)
+		}
+	}
+	table.Flush()
+	diff.Report = buf.String()
+	return diff, nil
+}
+
+func relativeDelta(old, cur float64) float64 {
+	if old == 0 {
+		if cur == 0 {
+			return 0
+		}
+		// было 0 аллокаций, стало сколько-то - это регрессия при любом пороге
+		return math.Inf(1)
+	}
+	return (cur - old) / old
+}
+
+func formatDelta(delta float64) string {
+	if math.IsInf(delta, 1) {
+		return "+inf"
+	}
+	return fmt.Sprintf("%+.1f%%", delta*100)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+// go test -run Baseline -baseline                  - сравнить с testdata/baseline.json
+// go test -run Baseline -baseline.update           - перезаписать его
+// go test -run Baseline -baseline -baseline.ns=false - без ns/op, если baseline с другой машины
+var (
+	baselineCheck     = flag.Bool("baseline", false, "compare search benchmarks with "+baselinePath)
+	baselineUpdate    = flag.Bool("baseline.update", false, "rewrite "+baselinePath)
+	baselineThreshold = flag.Float64("baseline.threshold", 0.2, "allowed growth of a metric, 0.2 is 20%")
+	baselineTime      = flag.Bool("baseline.ns", true, "compare ns/op, which depends on the machine")
+)
+
+const baselinePath = "testdata/baseline.json"
+
+// searchBenchmarks - то, что попадает в baseline; имена как у BenchmarkXxx без префикса
+var searchBenchmarks = map[string]func(out io.Writer) error{
+	"Slow":     func(out io.Writer) error { SlowSearch(out); return nil },
+	"Fast":     func(out io.Writer) error { FastSearch(out); return nil },
+	"Scan":     ScanSearch,
+	"Mmap":     MmapSearch,
+	"Buffered": BufferedSearch,
+	"Query":    func(out io.Writer) error { return QuerySearch(out, defaultQuery) },
+	"Parallel": func(out io.Writer) error { return ParallelSearch(out, defaultQuery, 0) },
+}
+
+func newBenchResult(r testing.BenchmarkResult) BenchResult {
+	return BenchResult{
+		NsPerOp:     math.Round(float64(r.T.Nanoseconds()) / float64(r.N)),
+		BytesPerOp:  r.AllocedBytesPerOp(),
+		AllocsPerOp: r.AllocsPerOp(),
+	}
+}
+
+func runBaseline(t *testing.T) *Baseline {
+	current := NewBaseline()
+	for name, search := range searchBenchmarks {
+		search := search
+		result := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := search(ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		if result.N == 0 {
+			t.Fatalf("%s: benchmark failed", name)
+		}
+		current.Benchmarks[name] = newBenchResult(result)
+	}
+	return current
+}
+
+func TestBaseline(t *testing.T) {
+	if !*baselineCheck && !*baselineUpdate {
+		t.Skip("run with -baseline or -baseline.update")
+	}
+	current := runBaseline(t)
+
+	if *baselineUpdate {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := current.Save(baselinePath); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s updated", baselinePath)
+		return
+	}
+
+	base, err := LoadBaseline(baselinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := CompareBaseline(base, current, *baselineThreshold, *baselineTime)
+	if err != nil {
+		t.Fatalf("%v; run with -baseline.ns=false or record a baseline here with -baseline.update", err)
+	}
+	t.Log("\n" + diff.Report)
+	if len(diff.Regressions) > 0 {
+		t.Errorf("regressions over %.0f%%:\n%s", *baselineThreshold*100, strings.Join(diff.Regressions, "\n"))
+	}
+	if len(diff.Missing) > 0 {
+		t.Errorf("in %s, but not run: %s", baselinePath, strings.Join(diff.Missing, ", "))
+	}
+}
+
+func TestCompareBaseline(t *testing.T) {
+	base := NewBaseline()
+	base.Benchmarks["Fast"] = BenchResult{NsPerOp: 1000, BytesPerOp: 100, AllocsPerOp: 10}
+	base.Benchmarks["Scan"] = BenchResult{NsPerOp: 500, BytesPerOp: 50, AllocsPerOp: 0}
+	base.Benchmarks["Gone"] = BenchResult{NsPerOp: 1}
+
+	current := NewBaseline()
+	current.Benchmarks["Fast"] = BenchResult{NsPerOp: 2000, BytesPerOp: 110, AllocsPerOp: 13}
+	current.Benchmarks["Scan"] = BenchResult{NsPerOp: 400, BytesPerOp: 50, AllocsPerOp: 1}
+	current.Benchmarks["New"] = BenchResult{NsPerOp: 1}
+
+	diff, err := CompareBaseline(base, current, 0.2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Fast ns/op: +100.0%", "Fast allocs/op: +30.0%", "Scan allocs/op: +inf"}
+	if strings.Join(diff.Regressions, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got regressions %q, expected %q", diff.Regressions, expected)
+	}
+	if len(diff.Missing) != 1 || diff.Missing[0] != "Gone" {
+		t.Errorf("got missing %q, expected [Gone]", diff.Missing)
+	}
+	for _, s := range []string{"+100.0%", "REGRESSION", "not in baseline", "MISSING", "-20.0%"} {
+		if !strings.Contains(diff.Report, s) {
+			t.Errorf("report has no %q:\n%s", s, diff.Report)
+		}
+	}
+
+	// другое число CPU: ns/op сравнивать нельзя, остальное можно
+	current.CPUs = base.CPUs + 1
+	if _, err := CompareBaseline(base, current, 0.2, true); err == nil {
+		t.Error("expected error for baseline from another number of CPUs")
+	}
+	diff, err = CompareBaseline(base, current, 0.5, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Regressions) != 1 || !strings.Contains(diff.Report, "not compared") {
+		t.Errorf("without ns/op: got %q\n%s", diff.Regressions, diff.Report)
+	}
+
+	path := t.TempDir() + "/baseline.json"
+	if err := base.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBaseline(path)
+	if err != nil || loaded.Benchmarks["Fast"] != base.Benchmarks["Fast"] {
+		t.Errorf("round trip: %+v, %v", loaded, err)
+	}
+	ioutil.WriteFile(path, []byte(`{"version":0}`), 0644)
+	if _, err := LoadBaseline(path); err == nil {
+		t.Error("expected version error")
+	}
+}
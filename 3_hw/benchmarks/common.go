@@ -14,6 +14,11 @@ import (
 const filePath string = "./data/users.txt"
 
 func SlowSearch(out io.Writer) {
+	SlowSearchMasked(out, DefaultMasking)
+}
+
+// SlowSearchMasked - SlowSearch, который выводит name и email по политикам masking
+func SlowSearchMasked(out io.Writer, masking Masking) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		panic(err)
@@ -24,7 +29,6 @@ func SlowSearch(out io.Writer) {
 		panic(err)
 	}
 
-	r := regexp.MustCompile("@")
 	seenBrowsers := []string{}
 	uniqueBrowsers := 0
 	foundUsers := ""
@@ -102,8 +106,9 @@ func SlowSearch(out io.Writer) {
 		}
 
 		// log.Println("Android and MSIE user:", user["name"], user["email"])
-		email := r.ReplaceAllString(user["email"].(string), " [at] ")
-		foundUsers += fmt.Sprintf("[%d] %s <%s>\n", i, user["name"], email)
+		name := masking.Name.Apply(user["name"].(string))
+		email := masking.Email.Apply(user["email"].(string))
+		foundUsers += fmt.Sprintf("[%d] %s <%s>\n", i, name, email)
 	}
 
 	fmt.Fprintln(out, "found users:\n"+foundUsers)
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compression - формат по первым байтам: gzip, zstd или "" - не сжато
+func compression(magic []byte) string {
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(magic, zstdMagic):
+		return "zstd"
+	}
+	return ""
+}
+
+// Decompress отдаёт r распакованным, формат определяется по магическим байтам;
+// несжатый вход отдаётся как есть. Close закрывает распаковщик, но не r.
+//
+// zstd распаковывается по блокам в нескольких горутинах. Поток deflate в gzip
+// последовательный, его можно только распаковывать в отдельной горутине
+// (readAhead), пока вызывающий разбирает уже распакованное.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch compression(magic) {
+	case "gzip":
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return newReadAhead(zr, zr.Close), nil
+	case "zstd":
+		zr, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{zr}, nil
+	}
+	return io.NopCloser(reader), nil
+}
+
+// zstdReader - декодер на один вход. Горутины, которые распаковывают блоки,
+// живут до Close, поэтому декодер не переиспользуется через sync.Pool: то, что
+// пул выбросит, никто не закроет.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r *zstdReader) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// inputFile - открытый файл с данными, распакованный при необходимости
+type inputFile struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (f *inputFile) Close() error {
+	err := f.ReadCloser.Close()
+	if fileErr := f.file.Close(); err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+// openInput открывает users.txt, users.txt.gz или users.txt.zst - по содержимому, не по имени
+func openInput(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := fileCompression(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if kind == "" {
+		// несжатый файл без лишнего буфера: у вызывающего свой
+		return file, nil
+	}
+	r, err := Decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &inputFile{ReadCloser: r, file: file}, nil
+}
+
+// fileCompression - формат файла по первым байтам, не сдвигая позицию чтения
+func fileCompression(file io.ReaderAt) (string, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := file.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return compression(magic[:n]), nil
+}
+
+const (
+	readAheadSize   = 256 << 10
+	readAheadBlocks = 4
+)
+
+// readAhead читает src в своей горутине на readAheadBlocks блоков вперёд
+type readAhead struct {
+	full     chan []byte // прочитанные блоки, закрывается по концу src
+	free     chan []byte // блоки, которые можно заполнять
+	done     chan struct{}
+	err      error // ошибка src кроме io.EOF, валидна после закрытия full
+	block    []byte
+	rest     []byte // непрочитанная часть block
+	closeSrc func() error
+	closed   bool
+}
+
+func newReadAhead(src io.Reader, closeSrc func() error) *readAhead {
+	ra := &readAhead{
+		full:     make(chan []byte, readAheadBlocks),
+		free:     make(chan []byte, readAheadBlocks),
+		done:     make(chan struct{}),
+		closeSrc: closeSrc,
+	}
+	for i := 0; i < readAheadBlocks; i++ {
+		ra.free <- make([]byte, readAheadSize)
+	}
+	go ra.fill(src)
+	return ra
+}
+
+func (ra *readAhead) fill(src io.Reader) {
+	defer close(ra.full)
+	for {
+		select {
+		case <-ra.done:
+			return
+		default:
+		}
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.done:
+			return
+		}
+
+		n := 0
+		var err error
+		for n < len(buf) && err == nil {
+			var m int
+			m, err = src.Read(buf[n:])
+			n += m
+		}
+		if n > 0 {
+			// блоков всего readAheadBlocks, так что в full всегда есть место
+			ra.full <- buf[:n]
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			ra.err = err
+			return
+		}
+	}
+}
+
+func (ra *readAhead) Read(p []byte) (int, error) {
+	for len(ra.rest) == 0 {
+		if ra.block != nil {
+			ra.free <- ra.block[:cap(ra.block)]
+			ra.block = nil
+		}
+		block, ok := <-ra.full
+		if !ok {
+			if ra.err != nil {
+				return 0, ra.err
+			}
+			return 0, io.EOF
+		}
+		ra.block, ra.rest = block, block
+	}
+	n := copy(p, ra.rest)
+	ra.rest = ra.rest[n:]
+	return n, nil
+}
+
+// Close останавливает горутину и закрывает src
+func (ra *readAhead) Close() error {
+	if ra.closed {
+		return nil
+	}
+	ra.closed = true
+	close(ra.done)
+	for range ra.full {
+	}
+	return ra.closeSrc()
+}
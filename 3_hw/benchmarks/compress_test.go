@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+var compressions = []string{"", "gzip", "zstd"}
+
+func compress(t testing.TB, data []byte, kind string) []byte {
+	buf := new(bytes.Buffer)
+	var w io.WriteCloser
+	switch kind {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "zstd":
+		enc, err := zstd.NewWriter(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = enc
+	default:
+		return data
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// compressedCopy - data/users.txt, сжатый kind, во временном каталоге
+func compressedCopy(t testing.TB, kind string) string {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "users.txt."+kind)
+	if err := ioutil.WriteFile(path, compress(t, data, kind), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDecompress(t *testing.T) {
+	// большой вход, чтобы readAhead прошёл по кругу все блоки
+	big := strings.Repeat(searchInput+"\n", readAheadBlocks*readAheadSize/len(searchInput))
+	for _, input := range []string{"", "{", searchInput, big} {
+		for _, kind := range compressions {
+			r, err := Decompress(bytes.NewReader(compress(t, []byte(input), kind)))
+			if err != nil {
+				t.Fatalf("%q, %d bytes: %v", kind, len(input), err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%q, %d bytes: %v", kind, len(input), err)
+			}
+			if string(got) != input {
+				t.Errorf("%q, %d bytes: got %d bytes back", kind, len(input), len(got))
+			}
+			if err := r.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
+
+func TestDecompressTruncated(t *testing.T) {
+	data := []byte(strings.Repeat(searchInput+"\n", 1000))
+	for _, kind := range []string{"gzip", "zstd"} {
+		packed := compress(t, data, kind)
+		r, err := Decompress(bytes.NewReader(packed[:len(packed)/2]))
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if _, err := Search(r, nil); err == nil {
+			t.Errorf("%s: expected error on truncated input", kind)
+		}
+		r.Close()
+	}
+
+	// Close до конца чтения не должен зависать
+	r, err := Decompress(bytes.NewReader(compress(t, data, "gzip")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read(make([]byte, 10))
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDecompressGoroutines - после Close распаковщик не оставляет горутин, дочитан вход или нет
+func TestDecompressGoroutines(t *testing.T) {
+	data := []byte(strings.Repeat(searchInput+"\n", 10000))
+	before := runtime.NumGoroutine()
+	for _, kind := range []string{"gzip", "zstd"} {
+		packed := compress(t, data, kind)
+		for i := 0; i < 20; i++ {
+			r, err := Decompress(bytes.NewReader(packed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i%2 == 0 {
+				io.Copy(ioutil.Discard, r)
+			} else {
+				r.Read(make([]byte, 10))
+			}
+			if err := r.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left after Close, %d before", n, before)
+	}
+}
+
+// TestCompressedSearch - сжатый файл даёт тот же вывод, что несжатый
+func TestCompressedSearch(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	searches := map[string]func(io.Writer, string) error{
+		"fast": func(out io.Writer, path string) error {
+			fastSearchFile(out, path, DefaultMasking)
+			return nil
+		},
+		"mmap":     func(out io.Writer, path string) error { return mmapSearchFile(out, path, Strict) },
+		"buffered": func(out io.Writer, path string) error { return bufferedSearchFile(out, path, Strict) },
+		"parallel": func(out io.Writer, path string) error { return parallelSearchFile(out, path, defaultQuery, 4, Strict) },
+	}
+	for _, kind := range []string{"gzip", "zstd"} {
+		path := compressedCopy(t, kind)
+		for name, search := range searches {
+			out := new(bytes.Buffer)
+			if err := search(out, path); err != nil {
+				t.Fatalf("%s, %s: %v", kind, name, err)
+			}
+			if out.String() != fastOut.String() {
+				t.Errorf("%s, %s: results not match\nGot:\n%v\nExpected:\n%v", kind, name, out, fastOut)
+			}
+		}
+
+		if _, err := BuildIndex(path); err == nil || !strings.Contains(err.Error(), kind) {
+			t.Errorf("%s: expected index error, got %v", kind, err)
+		}
+	}
+}
+
+// BenchmarkCompressed - пропускная способность по несжатым байтам: сколько MB/s
+// users.txt в секунду ищется, если файл лежит сжатым
+func BenchmarkCompressed(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, kind := range compressions {
+		name := kind
+		if name == "" {
+			name = "plain"
+		}
+		path := filePath
+		if kind != "" {
+			path = compressedCopy(b, kind)
+		}
+		b.Run(name+"/fast", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				fastSearchFile(ioutil.Discard, path, DefaultMasking)
+			}
+		})
+		b.Run(name+"/mmap", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				mmapSearchFile(ioutil.Discard, path, Strict)
+			}
+		})
+	}
+}
+
+// BenchmarkDecompress - одна распаковка, без поиска
+func BenchmarkDecompress(b *testing.B) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, kind := range []string{"gzip", "zstd"} {
+		packed := compress(b, data, kind)
+		b.Run(kind, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				r, err := Decompress(bytes.NewReader(packed))
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, r)
+				r.Close()
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"io"
-	"os"
 	"strconv"
 	"strings"
 
@@ -23,11 +22,24 @@ var (
 	msieByte    []byte = []byte(msie)
 )
 
+// FastSearch ищет по data/users.txt; файл может быть сжат gzip или zstd.
+// Сигнатура из задания не возвращает ошибку, поэтому на битой строке FastSearch
+// паникует; без паники - MmapSearch (*LineError) и TolerantSearch (пропуск).
 func FastSearch(out io.Writer) {
+	fastSearchFile(out, filePath, DefaultMasking)
+}
+
+// FastSearchMasked - FastSearch, который выводит name и email по политикам masking
+func FastSearchMasked(out io.Writer, masking Masking) {
+	fastSearchFile(out, filePath, masking)
+}
+
+// fastSearchFile - FastSearch по произвольному файлу, для бенчмарков на сгенерированных данных
+func fastSearchFile(out io.Writer, path string, masking Masking) {
 	writer := bufio.NewWriter(out)
 	defer writer.Flush()
 
-	file, err := os.Open(filePath)
+	file, err := openInput(path)
 	if err != nil {
 		panic(err)
 	}
@@ -67,15 +79,14 @@ func FastSearch(out io.Writer) {
 		}
 
 		if isAndroid && isMSIE {
-			email := strings.Replace(user.Email, "@", " [at] ", 1)
 			writer.WriteRune('[')
 			writer.WriteString(strconv.Itoa(i))
 			writer.WriteRune(']')
 			writer.WriteByte(' ')
-			writer.WriteString(user.Name)
+			masking.Name.write(writer, user.Name)
 			writer.WriteByte(' ')
 			writer.WriteRune('<')
-			writer.WriteString(email)
+			masking.Email.write(writer, user.Email)
 			writer.WriteRune('>')
 			writer.WriteByte('\n')
 		}
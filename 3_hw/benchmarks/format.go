@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Formatter выводит результат поиска
+type Formatter interface {
+	Format(w io.Writer, result *SearchResult) error
+}
+
+// NewFormatter - форматтер по имени: text, jsonl или csv; маскирование у всех DefaultMasking
+func NewFormatter(name string) (Formatter, error) {
+	switch name {
+	case "text":
+		return TextFormatter{}, nil
+	case "jsonl":
+		return JSONLinesFormatter{}, nil
+	case "csv":
+		return CSVFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected text, jsonl or csv", name)
+}
+
+// TextFormatter - формат FastSearch:
+//
+//	found users:
+//	[1] Name <user [at] example.com>
+//
+//	Total unique browsers 114
+//
+// Если в режиме Tolerant были пропущены строки, после итога идёт сводка:
+//
+//	Skipped 2 bad lines:
+//	line 17: parse error: ...
+type TextFormatter struct {
+	Masking *Masking // nil - DefaultMasking
+}
+
+func (f TextFormatter) Format(w io.Writer, result *SearchResult) error {
+	masking := f.Masking.orDefault()
+	writer := bufio.NewWriter(w)
+	writer.WriteString("found users:")
+	writer.WriteByte('\n')
+	for _, u := range result.Users {
+		writeFoundUser(writer, u.Index, u.Name, u.Email, masking)
+	}
+	writeTotal(writer, result.UniqueBrowsers)
+	writeSkipped(writer, result.Skipped, result.BadLines)
+	return writer.Flush()
+}
+
+func writeFoundUser(writer *bufio.Writer, i int, name, email string, masking Masking) {
+	writer.WriteRune('[')
+	writer.WriteString(strconv.Itoa(i))
+	writer.WriteRune(']')
+	writer.WriteByte(' ')
+	masking.Name.write(writer, name)
+	writer.WriteByte(' ')
+	writer.WriteRune('<')
+	masking.Email.write(writer, email)
+	writer.WriteRune('>')
+	writer.WriteByte('\n')
+}
+
+func writeTotal(writer *bufio.Writer, uniqueBrowsers int) {
+	writer.WriteString("\nTotal unique browsers ")
+	writer.WriteString(strconv.Itoa(uniqueBrowsers))
+	writer.WriteByte('\n')
+}
+
+// writeSkipped - сводка по битым строкам; ничего не пишет, если их не было
+func writeSkipped(writer *bufio.Writer, skipped int, errs []*LineError) {
+	if skipped == 0 {
+		return
+	}
+	fmt.Fprintf(writer, "\nSkipped %d bad lines:\n", skipped)
+	for _, lineErr := range errs {
+		writer.WriteString(lineErr.Error())
+		writer.WriteByte('\n')
+	}
+	if more := skipped - len(errs); more > 0 {
+		fmt.Fprintf(writer, "... and %d more\n", more)
+	}
+}
+
+// JSONLinesFormatter - по объекту FoundUser на строку, последней строкой итог:
+//
+//	{"index":1,"name":"Name","email":"user@example.com"}
+//	{"unique_browsers":114}
+//
+// В режиме Tolerant в итоге ещё skipped и bad_lines, если что-то пропущено:
+//
+//	{"unique_browsers":114,"skipped":1,"bad_lines":[{"line":17,"error":"parse error: ..."}]}
+type JSONLinesFormatter struct {
+	Masking *Masking // nil - DefaultMasking, как у TextFormatter
+}
+
+func (f JSONLinesFormatter) Format(w io.Writer, result *SearchResult) error {
+	writer := bufio.NewWriter(w)
+	enc := json.NewEncoder(writer)
+	masking := f.Masking.orDefault()
+	for _, u := range result.Users {
+		if err := enc.Encode(masking.user(u)); err != nil {
+			return err
+		}
+	}
+	type badLine struct {
+		Line  int    `json:"line"`
+		Error string `json:"error"`
+	}
+	var bad []badLine
+	for _, lineErr := range result.BadLines {
+		bad = append(bad, badLine{lineErr.Line, lineErr.Err.Error()})
+	}
+	if err := enc.Encode(struct {
+		UniqueBrowsers int       `json:"unique_browsers"`
+		Skipped        int       `json:"skipped,omitempty"`
+		BadLines       []badLine `json:"bad_lines,omitempty"`
+	}{result.UniqueBrowsers, result.Skipped, bad}); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// CSVFormatter - таблица index,name,email с заголовком; итог по браузерам в CSV не попадает
+type CSVFormatter struct {
+	Masking *Masking // nil - DefaultMasking, как у TextFormatter
+}
+
+func (f CSVFormatter) Format(w io.Writer, result *SearchResult) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"index", "name", "email"})
+	masking := f.Masking.orDefault()
+	for _, u := range result.Users {
+		u = masking.user(u)
+		writer.Write([]string{strconv.Itoa(u.Index), u.Name, u.Email})
+	}
+	writer.Flush()
+	return writer.Error()
+}
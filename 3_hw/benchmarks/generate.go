@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hw3/user"
+
+	"github.com/mailru/easyjson"
+)
+
+// browsersPerUser - в users.txt у каждого пользователя ровно 4 браузера
+const browsersPerUser = 4
+
+// variantRate - доля браузеров, у которых меняется номер сборки: без этого на
+// миллионе строк Total unique browsers упирается в 670 агентов из users.txt
+const variantRate = 0.05
+
+// Generator выдаёт строки в формате users.txt. Значения полей и их частоты
+// берутся из образца, так что распределение браузеров, стран и т.д. то же самое;
+// одинаковые образец и seed дают одинаковый результат.
+type Generator struct {
+	rnd        *rand.Rand
+	browsers   weighted
+	companies  weighted
+	countries  weighted
+	jobs       weighted
+	firstNames weighted
+	lastNames  weighted
+	locals     weighted // часть email до @
+	domains    weighted // после @ без зоны
+	zones      weighted
+	phones     weighted // форматы телефонов, цифры заменены на #
+	record     user.Record
+}
+
+// weighted - значения с накопленными частотами для выбора пропорционально частоте
+type weighted struct {
+	values []string
+	cum    []int
+}
+
+func newWeighted(counts map[string]int) weighted {
+	w := weighted{values: make([]string, 0, len(counts))}
+	for value := range counts {
+		w.values = append(w.values, value)
+	}
+	// порядок обхода map случаен, а выбор должен зависеть только от seed
+	sort.Strings(w.values)
+	total := 0
+	for _, value := range w.values {
+		total += counts[value]
+		w.cum = append(w.cum, total)
+	}
+	return w
+}
+
+func (w *weighted) pick(rnd *rand.Rand) string {
+	n := rnd.Intn(w.cum[len(w.cum)-1])
+	return w.values[sort.SearchInts(w.cum, n+1)]
+}
+
+// NewGenerator собирает словари из образца (обычно data/users.txt)
+func NewGenerator(sample io.Reader, seed int64) (*Generator, error) {
+	browsers, companies, countries := map[string]int{}, map[string]int{}, map[string]int{}
+	jobs, firstNames, lastNames := map[string]int{}, map[string]int{}, map[string]int{}
+	locals, domains, zones := map[string]int{}, map[string]int{}, map[string]int{}
+	phones := map[string]int{}
+
+	var record user.Record
+	scanner := bufio.NewScanner(sample)
+	for i := 0; scanner.Scan(); i++ {
+		record = user.Record{}
+		if err := easyjson.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, &LineError{Line: i, Err: err}
+		}
+		for _, browser := range record.Browsers {
+			browsers[browser]++
+		}
+		companies[record.Company]++
+		countries[record.Country]++
+		jobs[record.Job]++
+		if space := strings.IndexByte(record.Name, ' '); space > 0 {
+			firstNames[record.Name[:space]]++
+			lastNames[record.Name[space+1:]]++
+		}
+		if at := strings.IndexByte(record.Email, '@'); at > 0 {
+			locals[record.Email[:at]]++
+			domain := record.Email[at+1:]
+			if dot := strings.LastIndexByte(domain, '.'); dot > 0 {
+				domains[domain[:dot]]++
+				zones[domain[dot+1:]]++
+			}
+		}
+		if record.Phone != "" {
+			phones[phoneFormat(record.Phone)]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, c := range []map[string]int{browsers, companies, countries, jobs, firstNames, lastNames, locals, domains, zones, phones} {
+		if len(c) == 0 {
+			return nil, errEmptySample
+		}
+	}
+
+	return &Generator{
+		rnd:        rand.New(rand.NewSource(seed)),
+		browsers:   newWeighted(browsers),
+		companies:  newWeighted(companies),
+		countries:  newWeighted(countries),
+		jobs:       newWeighted(jobs),
+		firstNames: newWeighted(firstNames),
+		lastNames:  newWeighted(lastNames),
+		locals:     newWeighted(locals),
+		domains:    newWeighted(domains),
+		zones:      newWeighted(zones),
+		phones:     newWeighted(phones),
+	}, nil
+}
+
+var errEmptySample = errors.New("generator: sample has no usable lines")
+
+// Next - следующая запись; валидна до следующего вызова
+func (g *Generator) Next() *user.Record {
+	r := &g.record
+	r.Browsers = r.Browsers[:0]
+	for i := 0; i < browsersPerUser; i++ {
+		browser := g.browsers.pick(g.rnd)
+		if g.rnd.Float64() < variantRate {
+			browser = g.variant(browser)
+		}
+		r.Browsers = append(r.Browsers, browser)
+	}
+	r.Company = g.companies.pick(g.rnd)
+	r.Country = g.countries.pick(g.rnd)
+	r.Email = g.locals.pick(g.rnd) + "@" + g.domains.pick(g.rnd) + "." + g.zones.pick(g.rnd)
+	r.Job = g.jobs.pick(g.rnd)
+	r.Name = g.firstNames.pick(g.rnd) + " " + g.lastNames.pick(g.rnd)
+	r.Phone = g.phone(g.phones.pick(g.rnd))
+	return r
+}
+
+// phoneFormat - телефон с цифрами, заменёнными на #: 176-88-49 -> ###-##-##
+func phoneFormat(phone string) string {
+	format := []byte(phone)
+	for i, c := range format {
+		if c >= '0' && c <= '9' {
+			format[i] = '#'
+		}
+	}
+	return string(format)
+}
+
+// phone заполняет формат случайными цифрами
+func (g *Generator) phone(format string) string {
+	phone := []byte(format)
+	for i, c := range phone {
+		if c == '#' {
+			phone[i] = byte('0' + g.rnd.Intn(10))
+		}
+	}
+	return string(phone)
+}
+
+// variant меняет последнее число в строке браузера, как у новой сборки того же браузера
+func (g *Generator) variant(browser string) string {
+	end := strings.LastIndexAny(browser, "0123456789") + 1
+	if end == 0 {
+		return browser
+	}
+	start := end - 1
+	for start > 0 && browser[start-1] >= '0' && browser[start-1] <= '9' {
+		start--
+	}
+	return browser[:start] + strconv.Itoa(g.rnd.Intn(10000)) + browser[end:]
+}
+
+// WriteLines пишет n строк через \n; как в users.txt, без перевода строки в конце
+func (g *Generator) WriteLines(w io.Writer, n int) error {
+	writer := bufio.NewWriter(w)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			writer.WriteByte('\n')
+		}
+		if _, err := easyjson.MarshalToWriter(g.Next(), writer); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// GenerateFile пишет в path lines строк по образцу data/users.txt
+func GenerateFile(path string, seed int64, lines int) error {
+	sample, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer sample.Close()
+
+	g, err := NewGenerator(sample, seed)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := g.WriteLines(file, lines); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hw3/user"
+	"hw3/useragent"
+
+	"github.com/mailru/easyjson"
+)
+
+// go test -run XXX -bench Generated -gen.lines 1000000
+var genLines = flag.Int("gen.lines", 100000, "lines in the generated file for BenchmarkGenerated*")
+
+func newSampleGenerator(t testing.TB, seed int64) *Generator {
+	sample, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sample.Close()
+	g, err := NewGenerator(sample, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func generate(t testing.TB, seed int64, n int) []byte {
+	out := new(bytes.Buffer)
+	if err := newSampleGenerator(t, seed).WriteLines(out, n); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestGeneratorDeterministic(t *testing.T) {
+	a, b := generate(t, 1, 500), generate(t, 1, 500)
+	if !bytes.Equal(a, b) {
+		t.Error("same seed gave different data")
+	}
+	if bytes.Equal(a, generate(t, 2, 500)) {
+		t.Error("different seeds gave the same data")
+	}
+	// первые строки не зависят от того, сколько строк просили
+	if !bytes.HasPrefix(generate(t, 1, 1000), a) {
+		t.Error("longer output does not start with the shorter one")
+	}
+}
+
+func TestGeneratorSchema(t *testing.T) {
+	data := generate(t, 42, 2000)
+	if bytes.HasSuffix(data, []byte("\n")) {
+		t.Error("unexpected trailing newline")
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	if len(lines) != 2000 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	for i, line := range lines {
+		var r user.Record
+		if err := easyjson.Unmarshal(line, &r); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if len(r.Browsers) != browsersPerUser || r.Company == "" || r.Country == "" || r.Job == "" ||
+			!strings.Contains(r.Name, " ") || strings.Count(r.Email, "@") != 1 || !samplePhone(r.Phone) {
+			t.Fatalf("line %d: unexpected record %+v", i, r)
+		}
+		if i == 0 && !sameFieldOrder(line) {
+			t.Errorf("field order differs from users.txt: %s", line)
+		}
+	}
+}
+
+// samplePhone - телефон в одном из форматов users.txt
+func samplePhone(phone string) bool {
+	format := phoneFormat(phone)
+	return format == "###-##-##" || format == "#-###-###-##-##"
+}
+
+// sameFieldOrder - поля по алфавиту, как в users.txt
+func sameFieldOrder(line []byte) bool {
+	prev := -1
+	for _, key := range []string{"browsers", "company", "country", "email", "job", "name", "phone"} {
+		i := bytes.Index(line, []byte(`"`+key+`":`))
+		if i <= prev {
+			return false
+		}
+		prev = i
+	}
+	return true
+}
+
+// TestGeneratorDistribution - доли семейств браузеров такие же, как в образце
+func TestGeneratorDistribution(t *testing.T) {
+	shares := func(lines [][]byte) map[string]float64 {
+		counts := map[string]float64{}
+		total := 0.0
+		for _, line := range lines {
+			var r user.Record
+			if err := easyjson.Unmarshal(line, &r); err != nil {
+				t.Fatal(err)
+			}
+			for _, b := range r.Browsers {
+				counts[useragent.Parse(b).Browser]++
+				total++
+			}
+		}
+		for family := range counts {
+			counts[family] /= total
+		}
+		return counts
+	}
+
+	sample := shares(readLines(t))
+	generated := shares(bytes.Split(generate(t, 7, 20000), []byte("\n")))
+	for _, family := range []string{"Firefox", "Chrome", "Safari", "Android Browser", "Opera", "IE"} {
+		if diff := generated[family] - sample[family]; diff > 0.015 || diff < -0.015 {
+			t.Errorf("%s: %.3f in generated data, %.3f in sample", family, generated[family], sample[family])
+		}
+	}
+}
+
+func TestGeneratorPhones(t *testing.T) {
+	// в образце примерно поровну ###-##-## и #-###-###-##-##
+	long := func(lines [][]byte) float64 {
+		n := 0
+		for _, line := range lines {
+			var r user.Record
+			if err := easyjson.Unmarshal(line, &r); err != nil {
+				t.Fatal(err)
+			}
+			if phoneFormat(r.Phone) == "#-###-###-##-##" {
+				n++
+			}
+		}
+		return float64(n) / float64(len(lines))
+	}
+
+	sample, generated := long(readLines(t)), long(bytes.Split(generate(t, 7, 20000), []byte("\n")))
+	if sample < 0.3 || generated-sample > 0.015 || generated-sample < -0.015 {
+		t.Errorf("long phones: %.3f in generated data, %.3f in sample", generated, sample)
+	}
+}
+
+func TestGeneratedSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := GenerateFile(path, 3, 5000); err != nil {
+		t.Fatal(err)
+	}
+
+	fastOut := new(bytes.Buffer)
+	fastSearchFile(fastOut, path, DefaultMasking)
+	result := searchFile(t, path, nil)
+	out := new(bytes.Buffer)
+	TextFormatter{}.Format(out, result)
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+	// сборки-варианты дают больше уникальных браузеров, чем в образце
+	if sample := searchFile(t, filePath, nil); len(result.Users) == 0 || result.UniqueBrowsers <= sample.UniqueBrowsers {
+		t.Errorf("got %d users, %d unique browsers, sample has %d", len(result.Users), result.UniqueBrowsers, sample.UniqueBrowsers)
+	}
+}
+
+// generatedFile - файл на *genLines строк во временном каталоге бенчмарка
+func generatedFile(b *testing.B) string {
+	path := filepath.Join(b.TempDir(), "users.txt")
+	if err := GenerateFile(path, 1, *genLines); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkGeneratedFast(b *testing.B) {
+	path := generatedFile(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fastSearchFile(ioutil.Discard, path, DefaultMasking)
+	}
+}
+
+func BenchmarkGeneratedMmap(b *testing.B) {
+	path := generatedFile(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mmapSearchFile(ioutil.Discard, path, Strict)
+	}
+}
+
+func BenchmarkGeneratedParallel(b *testing.B) {
+	path := generatedFile(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parallelSearchFile(ioutil.Discard, path, defaultQuery, 0, Strict)
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	g := newSampleGenerator(b, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.WriteLines(ioutil.Discard, 1000)
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"hw3/user"
+
+	"github.com/mailru/easyjson"
+)
+
+// Index - инвертированный индекс по users.txt: ключ -> номера строк по возрастанию.
+// Ключи: browser:<токен из browsers>, country:<страна>, company:<компания>,
+// domain:<часть email после @>. По номеру строки Offsets даёт её начало в файле,
+// так что поиск читает с диска только строки-кандидаты.
+//
+// Индекс сужает выборку, но не заменяет запрос: каждая строка-кандидат всё равно
+// проверяется Query.Match, поэтому результат совпадает с Search.
+type Index struct {
+	Size     int64   // сколько байт файла проиндексировано
+	ModTime  int64   // mtime файла в наносекундах на момент индексации
+	TailSum  uint32  // crc32 последних tailSize проиндексированных байт
+	Partial  bool    // последняя строка без перевода строки, после дописывания её надо переиндексировать
+	Offsets  []int64 // начала строк
+	Postings map[string][]uint32
+}
+
+var errStaleIndex = errors.New("index: data file changed since indexing, call Update")
+
+// tailSize - сколько байт в конце проиндексированной части сверяется по crc32.
+// Хеш всего файла пришлось бы считать на каждый поиск, а индекс нужен, чтобы не
+// читать файл целиком; хвост ловит перезапись того же размера, если у неё
+// сохранили mtime.
+const tailSize = 4096
+
+func newIndex() *Index {
+	return &Index{Postings: make(map[string][]uint32)}
+}
+
+// BuildIndex индексирует файл целиком
+func BuildIndex(dataPath string) (*Index, error) {
+	idx := newIndex()
+	if _, err := idx.Update(dataPath); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Update дочитывает строки, дописанные в файл после прошлой индексации, и
+// возвращает их число. Если файл не дописан, а переписан (rewritten), индекс
+// строится заново.
+func (idx *Index) Update(dataPath string) (int, error) {
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	rewritten, err := idx.rewritten(file, info)
+	if err != nil {
+		return 0, err
+	}
+	if rewritten {
+		*idx = *newIndex()
+	}
+	if info.Size() == idx.Size {
+		return 0, idx.stamp(file, info)
+	}
+	if idx.Size == 0 {
+		// смещения в индексе - по несжатому файлу
+		if kind, err := fileCompression(file); err != nil {
+			return 0, err
+		} else if kind != "" {
+			return 0, fmt.Errorf("index: %s is %s compressed, index needs an uncompressed file", dataPath, kind)
+		}
+	}
+
+	start := idx.Size
+	if idx.Partial {
+		// строку без \n могли дописать, убираем её и читаем заново
+		start = idx.dropLastLine()
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	added := 0
+	offset := start
+	reader := bufio.NewReader(file)
+	var record user.Record
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			i := len(idx.Offsets)
+			// пустую строку поиск по файлу отсеивает без разбора: в индексе она
+			// остаётся строкой без ключей, чтобы номера строк совпадали
+			if trimmed := trimLine(line); len(trimmed) > 0 {
+				record = user.Record{Browsers: record.Browsers[:0]}
+				if err := easyjson.Unmarshal(trimmed, &record); err != nil {
+					return added, &LineError{Line: i, Err: err}
+				}
+				idx.add(uint32(i), &record)
+			}
+			idx.Offsets = append(idx.Offsets, offset)
+			idx.Partial = line[len(line)-1] != '\n'
+			offset += int64(len(line))
+			idx.Size = offset
+			added++
+		}
+		if err == io.EOF {
+			return added, idx.stamp(file, info)
+		}
+		if err != nil {
+			return added, err
+		}
+	}
+}
+
+// rewritten - файл не дописан, а переписан: стал короче, при том же размере
+// сменилось mtime или изменился хвост проиндексированной части
+func (idx *Index) rewritten(file io.ReaderAt, info os.FileInfo) (bool, error) {
+	if info.Size() < idx.Size {
+		return true, nil
+	}
+	if info.Size() == idx.Size && info.ModTime().UnixNano() != idx.ModTime {
+		return true, nil
+	}
+	sum, err := tailSum(file, idx.Size)
+	return sum != idx.TailSum, err
+}
+
+// stamp запоминает mtime и хвост файла, по которому построен индекс
+func (idx *Index) stamp(file io.ReaderAt, info os.FileInfo) error {
+	sum, err := tailSum(file, idx.Size)
+	if err != nil {
+		return err
+	}
+	idx.ModTime, idx.TailSum = info.ModTime().UnixNano(), sum
+	return nil
+}
+
+// tailSum - crc32 байт [size-tailSize, size) файла
+func tailSum(file io.ReaderAt, size int64) (uint32, error) {
+	start := size - tailSize
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, size-start)
+	if _, err := file.ReadAt(buf, start); err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// trimLine - строка без \n и \r, как её отдаёт bufio.Scanner
+func trimLine(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line
+}
+
+func (idx *Index) dropLastLine() int64 {
+	last := len(idx.Offsets) - 1
+	for key, lines := range idx.Postings {
+		if n := len(lines); lines[n-1] == uint32(last) {
+			if n == 1 {
+				delete(idx.Postings, key)
+			} else {
+				idx.Postings[key] = lines[:n-1]
+			}
+		}
+	}
+	start := idx.Offsets[last]
+	idx.Offsets = idx.Offsets[:last]
+	idx.Size, idx.Partial = start, false
+	return start
+}
+
+func (idx *Index) add(i uint32, r *user.Record) {
+	for _, browser := range r.Browsers {
+		for _, token := range indexTokens(browser) {
+			idx.post("browser:"+token, i)
+		}
+	}
+	idx.post("country:"+r.Country, i)
+	idx.post("company:"+r.Company, i)
+	// у "a@b@c" ищем по всем частям после @, чтобы email has "@c" не потерялся
+	for email := r.Email; ; {
+		at := strings.IndexByte(email, '@')
+		if at < 0 {
+			break
+		}
+		email = email[at+1:]
+		idx.post("domain:"+email, i)
+	}
+}
+
+func (idx *Index) post(key string, i uint32) {
+	lines := idx.Postings[key]
+	if n := len(lines); n == 0 || lines[n-1] != i {
+		idx.Postings[key] = append(lines, i)
+	}
+}
+
+// indexTokens режет строку на куски из букв, цифр и не-ASCII байтов
+func indexTokens(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r < 0x80 && !isIdentByte(byte(r)) || r == '_'
+	})
+}
+
+// Save пишет индекс через временный файл, чтобы не оставить его недописанным
+func (idx *Index) Save(indexPath string) error {
+	tmp := indexPath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := gob.NewEncoder(writer).Encode(idx); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, indexPath)
+}
+
+func LoadIndex(indexPath string) (*Index, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := newIndex()
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("index %s: %v", indexPath, err)
+	}
+	return idx, nil
+}
+
+// OpenIndex загружает индекс (или строит, если его нет), дочитывает новые строки
+// и сохраняет, если что-то изменилось
+func OpenIndex(dataPath, indexPath string) (*Index, error) {
+	idx, err := LoadIndex(indexPath)
+	created := os.IsNotExist(err)
+	if created {
+		idx, err = newIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	size, lines, modTime, tail := idx.Size, len(idx.Offsets), idx.ModTime, idx.TailSum
+	if _, err := idx.Update(dataPath); err != nil {
+		return nil, err
+	}
+	if created || idx.Size != size || len(idx.Offsets) != lines ||
+		idx.ModTime != modTime || idx.TailSum != tail {
+		if err := idx.Save(indexPath); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// IndexSearch - QuerySearch через индекс indexPath рядом с users.txt. Режима
+// Tolerant нет: индекс строится только по разобранным строкам, и на битой
+// OpenIndex вернёт *LineError из Update.
+func IndexSearch(out io.Writer, indexPath string, q *Query) error {
+	idx, err := OpenIndex(filePath, indexPath)
+	if err != nil {
+		return err
+	}
+	result, err := idx.Search(filePath, q)
+	if err != nil {
+		return err
+	}
+	return TextFormatter{}.Format(out, result)
+}
+
+// Search читает только строки-кандидаты и проверяет их запросом; nil q - DefaultQuery
+func (idx *Index) Search(dataPath string, q *Query) (*SearchResult, error) {
+	if q == nil {
+		q = defaultQuery
+	}
+
+	file, err := os.Open(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != idx.Size || info.ModTime().UnixNano() != idx.ModTime {
+		return nil, errStaleIndex
+	}
+	if sum, err := tailSum(file, idx.Size); err != nil {
+		return nil, err
+	} else if sum != idx.TailSum {
+		return nil, errStaleIndex
+	}
+
+	// кандидаты - строки, подходящие под запрос, и строки с браузерами для статистики
+	candidates := idx.plan(q.root)
+	for _, c := range q.browsers {
+		if c.op != opNe {
+			candidates = candidates.union(idx.plan(c))
+		}
+	}
+
+	result := &SearchResult{Lines: len(idx.Offsets)}
+	seenBrowsers := make(map[string]struct{}, 1000)
+	var record user.Record
+	var buf []byte
+	visit := func(i int) error {
+		end := idx.Size
+		if i+1 < len(idx.Offsets) {
+			end = idx.Offsets[i+1]
+		}
+		if cap(buf) < int(end-idx.Offsets[i]) {
+			buf = make([]byte, end-idx.Offsets[i])
+		}
+		line := buf[:end-idx.Offsets[i]]
+		if _, err := file.ReadAt(line, idx.Offsets[i]); err != nil {
+			return err
+		}
+
+		line = trimLine(line)
+		if len(line) == 0 {
+			return nil
+		}
+		record = user.Record{Browsers: record.Browsers[:0]}
+		if err := easyjson.Unmarshal(line, &record); err != nil {
+			return &LineError{Line: i, Err: err}
+		}
+		for _, browser := range record.Browsers {
+			if q.countsBrowser(browser) {
+				seenBrowsers[browser] = struct{}{}
+			}
+		}
+		if q.Match(&record) {
+			result.Users = append(result.Users, FoundUser{Index: i, Name: record.Name, Email: record.Email})
+		}
+		return nil
+	}
+
+	if candidates.all {
+		for i := range idx.Offsets {
+			if err := visit(i); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, i := range candidates.lines {
+			if err := visit(int(i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result.UniqueBrowsers = len(seenBrowsers)
+	return result, nil
+}
+
+// lineSet - номера строк по возрастанию; all - индекс ничего не отсёк
+type lineSet struct {
+	all   bool
+	lines []uint32
+}
+
+var allLines = lineSet{all: true}
+
+// plan - надмножество строк, на которых node может быть истинным
+func (idx *Index) plan(node queryNode) lineSet {
+	switch n := node.(type) {
+	case andNode:
+		return idx.plan(n.left).intersect(idx.plan(n.right))
+	case orNode:
+		return idx.plan(n.left).union(idx.plan(n.right))
+	case *condition:
+		return idx.planCondition(n)
+	}
+	// not и всё неизвестное
+	return allLines
+}
+
+func (idx *Index) planCondition(c *condition) lineSet {
+	if c.op == opNe {
+		return allLines
+	}
+
+	switch c.field {
+	case fieldBrowsers:
+		// каждый кусок значения целиком лежит внутри какого-то токена браузера
+		tokens := indexTokens(c.value)
+		if len(tokens) == 0 {
+			return allLines
+		}
+		set := allLines
+		for _, token := range tokens {
+			set = set.intersect(idx.keysMatching("browser:", func(key string) bool {
+				return strings.Contains(key, token)
+			}))
+		}
+		return set
+	case fieldCountry, fieldCompany:
+		prefix := "country:"
+		if c.field == fieldCompany {
+			prefix = "company:"
+		}
+		if c.op == opEq {
+			return lineSet{lines: idx.Postings[prefix+c.value]}
+		}
+		return idx.keysMatching(prefix, func(key string) bool { return strings.Contains(key, c.value) })
+	case fieldEmail:
+		// по домену ищем только то, что начинается с @, остальное может быть в имени ящика
+		at := strings.IndexByte(c.value, '@')
+		switch {
+		case c.op == opEq && at >= 0:
+			return lineSet{lines: idx.Postings["domain:"+c.value[at+1:]]}
+		case c.op == opHas && at == 0:
+			domain := c.value[1:]
+			return idx.keysMatching("domain:", func(key string) bool { return strings.HasPrefix(key, domain) })
+		}
+	}
+	return allLines
+}
+
+func (idx *Index) keysMatching(prefix string, match func(key string) bool) lineSet {
+	var lines []uint32
+	for key, posting := range idx.Postings {
+		if strings.HasPrefix(key, prefix) && match(key[len(prefix):]) {
+			lines = append(lines, posting...)
+		}
+	}
+	// сливать ключи попарно выходит квадратично, проще отсортировать один раз
+	sort.Slice(lines, func(i, j int) bool { return lines[i] < lines[j] })
+	unique := lines[:0]
+	for i, line := range lines {
+		if i == 0 || line != lines[i-1] {
+			unique = append(unique, line)
+		}
+	}
+	return lineSet{lines: unique}
+}
+
+func (s lineSet) union(other lineSet) lineSet {
+	if s.all || other.all {
+		return allLines
+	}
+	lines := make([]uint32, 0, len(s.lines)+len(other.lines))
+	i, j := 0, 0
+	for i < len(s.lines) || j < len(other.lines) {
+		switch {
+		case j == len(other.lines) || i < len(s.lines) && s.lines[i] < other.lines[j]:
+			lines = append(lines, s.lines[i])
+			i++
+		case i == len(s.lines) || other.lines[j] < s.lines[i]:
+			lines = append(lines, other.lines[j])
+			j++
+		default:
+			lines = append(lines, s.lines[i])
+			i++
+			j++
+		}
+	}
+	return lineSet{lines: lines}
+}
+
+func (s lineSet) intersect(other lineSet) lineSet {
+	if s.all {
+		return other
+	}
+	if other.all {
+		return s
+	}
+	var lines []uint32
+	for i, j := 0, 0; i < len(s.lines) && j < len(other.lines); {
+		switch {
+		case s.lines[i] < other.lines[j]:
+			i++
+		case other.lines[j] < s.lines[i]:
+			j++
+		default:
+			lines = append(lines, s.lines[i])
+			i++
+			j++
+		}
+	}
+	return lineSet{lines: lines}
+}
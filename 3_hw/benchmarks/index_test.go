@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var indexQueries = []string{
+	DefaultQuery,
+	`browsers has "Android" and country = "Kenya"`,
+	`(browsers has "Opera" or browsers has "Safari") and not company has "Inc" and job != "Developer"`,
+	`browsers has "Windows NT 6.1" and browsers has "rv:11"`,
+	`browsers = "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko"`,
+	`country = "Malta" or company has "cube"`,
+	`email has "@Yodel" or email = "JonathanMorris@Muxo.edu"`,
+	`email has ".edu" and browsers has "Linux"`,
+	`browser = "IE" and browsers has "Trident"`,
+	`browsers has "_" or browsers has "("`,
+}
+
+func searchFile(t testing.TB, path string, q *Query) *SearchResult {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	result, err := Search(file, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestIndexSearch(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "users.idx")
+	idx, err := OpenIndex(filePath, indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, src := range indexQueries {
+		q := MustCompileQuery(src)
+		got, err := idx.Search(filePath, q)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if expected := searchFile(t, filePath, q); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: got %+v, expected %+v", src, got, expected)
+		}
+	}
+
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+	out := new(bytes.Buffer)
+	if err := IndexSearch(out, indexPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+}
+
+func TestIndexPlan(t *testing.T) {
+	idx, err := BuildIndex(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{
+		`country = "Malta"`:                     10,
+		`country = "Malta" and name = "x"`:      10,
+		`country = "Nowhere"`:                   0,
+		`browsers has "Trident/7.0"`:            -1, // меньше всех строк
+		`country = "Malta" or not name = "x"`:   len(idx.Offsets),
+		`browsers has "" and country = "Malta"`: 10,
+	}
+	for src, expected := range cases {
+		set := idx.plan(MustCompileQuery(src).root)
+		n := len(set.lines)
+		if set.all {
+			n = len(idx.Offsets)
+		}
+		if expected < 0 && n >= len(idx.Offsets) || expected >= 0 && n != expected {
+			t.Errorf("%s: %d candidates", src, n)
+		}
+	}
+}
+
+func TestIndexUpdate(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "users.txt")
+	indexPath := filepath.Join(dir, "users.idx")
+	lines := strings.Split(searchInput, "\n")
+
+	write := func(data string) {
+		if err := ioutil.WriteFile(dataPath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(step string, expectedLines int) {
+		idx, err := OpenIndex(dataPath, indexPath)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if len(idx.Offsets) != expectedLines {
+			t.Fatalf("%s: %d lines indexed, expected %d", step, len(idx.Offsets), expectedLines)
+		}
+		fresh, err := BuildIndex(dataPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(idx, fresh) {
+			t.Errorf("%s: updated index differs from rebuilt one", step)
+		}
+		for _, src := range indexQueries {
+			q := MustCompileQuery(src)
+			got, err := idx.Search(dataPath, q)
+			if err != nil {
+				t.Fatalf("%s, %s: %v", step, src, err)
+			}
+			if expected := searchFile(t, dataPath, q); !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s, %s: got %+v, expected %+v", step, src, got, expected)
+			}
+		}
+	}
+
+	// последняя строка без \n, к ней дописывают новые
+	write(lines[0])
+	check("first line", 1)
+	write(lines[0] + "\n" + lines[1] + "\n")
+	check("appended after partial line", 2)
+	write(lines[0] + "\n" + lines[1] + "\n" + lines[2])
+	check("appended after newline", 3)
+	write(lines[0])
+	check("truncated", 1)
+
+	idx, _ := LoadIndex(indexPath)
+	write(searchInput)
+	if _, err := idx.Search(dataPath, nil); err != errStaleIndex {
+		t.Errorf("expected stale index error, got %v", err)
+	}
+	if added, err := idx.Update(dataPath); err != nil || added != 3 {
+		t.Errorf("expected 3 lines added, got %d, %v", added, err)
+	}
+
+	// перезапись того же размера с прежним mtime: индекс сверяет хвост файла
+	check("before rewrite", 3)
+	info, err := os.Stat(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(strings.Replace(searchInput, "Bob", "Rob", 1))
+	if err := os.Chtimes(dataPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	idx, _ = LoadIndex(indexPath)
+	if _, err := idx.Search(dataPath, nil); err != errStaleIndex {
+		t.Errorf("rewrite: expected stale index error, got %v", err)
+	}
+	check("rewritten with the same size and mtime", 3)
+	if idx, _ = LoadIndex(indexPath); idx == nil {
+		t.Fatal("index not saved")
+	}
+	if _, err := idx.Search(dataPath, nil); err != nil {
+		t.Errorf("rebuilt index was not saved: %v", err)
+	}
+
+	// только mtime: сверить весь файл дорого, индекс считается устаревшим
+	later := info.ModTime().Add(time.Hour)
+	if err := os.Chtimes(dataPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idx.Search(dataPath, nil); err != errStaleIndex {
+		t.Errorf("touch: expected stale index error, got %v", err)
+	}
+	check("touched", 3)
+}
+
+func TestIndexBlankLines(t *testing.T) {
+	dataPath := filepath.Join(t.TempDir(), "users.txt")
+	lines := strings.Split(searchInput, "\n")
+	data := "\n" + lines[0] + "\n\r\n" + strings.Join(lines[1:], "\n") + "\n\n"
+	if err := ioutil.WriteFile(dataPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := BuildIndex(dataPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Size != int64(len(data)) {
+		t.Errorf("indexed %d bytes of %d", idx.Size, len(data))
+	}
+	for _, src := range indexQueries {
+		q := MustCompileQuery(src)
+		got, err := idx.Search(dataPath, q)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		if expected := searchFile(t, dataPath, q); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: got %+v, expected %+v", src, got, expected)
+		}
+	}
+}
+
+func BenchmarkIndexSearch(b *testing.B) {
+	indexPath := filepath.Join(b.TempDir(), "users.idx")
+	if _, err := OpenIndex(filePath, indexPath); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		IndexSearch(ioutil.Discard, indexPath, nil)
+	}
+}
+
+// условие на browsers тянет за собой все строки с этим браузером ради Total unique
+// browsers, поэтому выборочный запрос - без него
+const selectiveQuery = `country = "Malta" or company = "Livetube"`
+
+// BenchmarkIndexSelective и BenchmarkScanSelective - индекс против полного прохода
+// на запросе, под который подходит малая часть строк
+func BenchmarkIndexSelective(b *testing.B) {
+	idx, err := BuildIndex(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	q := MustCompileQuery(selectiveQuery)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Search(filePath, q)
+	}
+}
+
+func BenchmarkScanSelective(b *testing.B) {
+	q := MustCompileQuery(selectiveQuery)
+	for i := 0; i < b.N; i++ {
+		QuerySearch(ioutil.Discard, q)
+	}
+}
+
+func BenchmarkBuildIndex(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		BuildIndex(filePath)
+	}
+}
+
+// BenchmarkIndexDefault - DefaultQuery по уже загруженному индексу: Android и MSIE
+// есть в 58% строк, так что индекс мало что отсекает, и время то же, что у
+// BenchmarkQuery - разбор user.Record целиком; FastSearch быстрее за счёт разбора
+// только browsers, name и email
+func BenchmarkIndexDefault(b *testing.B) {
+	idx, err := BuildIndex(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Search(filePath, nil)
+	}
+}
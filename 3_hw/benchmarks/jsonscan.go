@@ -0,0 +1,577 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// userScanner - разбор строки users.txt без easyjson и без аллокаций: достаёт
+// browsers, name и email, остальные поля только проверяет на корректность и пропускает.
+// Ведёт себя как json.Unmarshal в user.User: ключи без учёта регистра, последний
+// дубль побеждает, null не меняет строку, битый UTF-8 заменяется на U+FFFD.
+//
+// Browsers, Name и Email ссылаются на line или на внутренний буфер и валидны
+// до следующего вызова scan.
+type userScanner struct {
+	Browsers [][]byte
+	Name     []byte
+	Email    []byte
+
+	data  []byte
+	pos   int
+	buf   []byte // строки с escape-последовательностями раскодируются сюда
+	stack []byte // закрывающие скобки при пропуске вложенных значений
+
+	browsers    []span
+	browsersLen int
+	name, email span
+}
+
+// span - кусок data или buf: пока идёт разбор, buf может переехать при росте,
+// поэтому срезы собираются только в конце
+type span struct {
+	start, end int
+	decoded    bool
+}
+
+var (
+	keyBrowsers = []byte("browsers")
+	keyName     = []byte("name")
+	keyEmail    = []byte("email")
+	literalNull = []byte("null")
+)
+
+// как в encoding/json
+const maxNestingDepth = 10000
+
+type scanError struct {
+	pos int
+	msg string
+}
+
+func (e *scanError) Error() string {
+	return fmt.Sprintf("json: %s at offset %d", e.msg, e.pos)
+}
+
+func (s *userScanner) fail(msg string) error {
+	return &scanError{pos: s.pos, msg: msg}
+}
+
+func (s *userScanner) scan(line []byte) error {
+	s.data, s.pos = line, 0
+	s.buf = s.buf[:0]
+	s.browsers, s.browsersLen = s.browsers[:0], 0
+	s.name, s.email = span{}, span{}
+	s.Browsers, s.Name, s.Email = s.Browsers[:0], nil, nil
+
+	if err := s.scanObject(); err != nil {
+		return err
+	}
+	s.skipSpace()
+	if s.pos != len(s.data) {
+		return s.fail("invalid character after top-level value")
+	}
+
+	for _, b := range s.browsers[:s.browsersLen] {
+		s.Browsers = append(s.Browsers, s.bytes(b))
+	}
+	s.Name, s.Email = s.bytes(s.name), s.bytes(s.email)
+	return nil
+}
+
+func (s *userScanner) scanObject() error {
+	s.skipSpace()
+	if bytes.HasPrefix(s.data[s.pos:], literalNull) {
+		// json.Unmarshal("null") ничего не делает
+		s.pos += len(literalNull)
+		return nil
+	}
+	if !s.consume('{') {
+		return s.fail("expected object")
+	}
+	s.skipSpace()
+	if s.consume('}') {
+		return nil
+	}
+
+	for {
+		s.skipSpace()
+		key, err := s.readString()
+		if err != nil {
+			return err
+		}
+		s.skipSpace()
+		if !s.consume(':') {
+			return s.fail("expected colon after object key")
+		}
+		s.skipSpace()
+
+		k := s.bytes(key)
+		switch {
+		case bytes.EqualFold(k, keyBrowsers):
+			err = s.scanBrowsers()
+		case bytes.EqualFold(k, keyName):
+			err = s.scanStringField(&s.name, 1)
+		case bytes.EqualFold(k, keyEmail):
+			err = s.scanStringField(&s.email, 1)
+		default:
+			err = s.skipValue(1)
+		}
+		if err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		if s.consume(',') {
+			continue
+		}
+		if s.consume('}') {
+			return nil
+		}
+		return s.fail("expected comma or end of object")
+	}
+}
+
+// depth - сколько объектов и массивов вокруг значения
+func (s *userScanner) scanStringField(dst *span, depth int) error {
+	if s.peek() != '"' {
+		return s.skipNullOrFail("expected string", depth)
+	}
+	str, err := s.readString()
+	if err != nil {
+		return err
+	}
+	*dst = str
+	return nil
+}
+
+// scanBrowsers повторяет json.Unmarshal в существующий срез: при повторном ключе
+// он пишет поверх старых элементов, а null оставляет в ячейке старое значение,
+// в том числе за длиной среза, но в пределах его ёмкости. Поэтому s.browsers
+// хранит все когда-либо записанные ячейки, а длина результата - в s.browsersLen.
+func (s *userScanner) scanBrowsers() error {
+	if s.peek() != '[' {
+		s.browsers, s.browsersLen = s.browsers[:0], 0
+		return s.skipNullOrFail("expected array of strings", 1)
+	}
+	s.pos++
+	s.skipSpace()
+	if s.consume(']') {
+		s.browsers, s.browsersLen = s.browsers[:0], 0
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		if i == len(s.browsers) {
+			s.browsers = append(s.browsers, span{})
+		}
+		s.skipSpace()
+		if err := s.scanStringField(&s.browsers[i], 2); err != nil {
+			return err
+		}
+
+		s.skipSpace()
+		if s.consume(',') {
+			continue
+		}
+		if s.consume(']') {
+			s.browsersLen = i + 1
+			return nil
+		}
+		return s.fail("expected comma or end of array")
+	}
+}
+
+func (s *userScanner) skipNullOrFail(msg string, depth int) error {
+	if bytes.HasPrefix(s.data[s.pos:], literalNull) {
+		s.pos += len(literalNull)
+		return nil
+	}
+	// encoding/json сначала проверяет синтаксис, поэтому синтаксическая ошибка
+	// важнее несовпадения типа
+	if err := s.skipValue(depth); err != nil {
+		return err
+	}
+	return s.fail(msg)
+}
+
+// skipValue пропускает любое значение, проверяя синтаксис
+func (s *userScanner) skipValue(depth int) error {
+	s.stack = s.stack[:0]
+	for {
+		s.skipSpace()
+		switch c := s.peek(); {
+		case c == '{' || c == '[':
+			if depth+len(s.stack)+1 > maxNestingDepth {
+				return s.fail("exceeded max depth")
+			}
+			s.pos++
+			s.skipSpace()
+			if c == '{' {
+				if s.consume('}') {
+					break
+				}
+				s.stack = append(s.stack, '}')
+				if err := s.skipKey(); err != nil {
+					return err
+				}
+				continue
+			}
+			if s.consume(']') {
+				break
+			}
+			s.stack = append(s.stack, ']')
+			continue
+		case c == '"':
+			if _, err := s.readString(); err != nil {
+				return err
+			}
+		case c == 't':
+			if err := s.literal("true"); err != nil {
+				return err
+			}
+		case c == 'f':
+			if err := s.literal("false"); err != nil {
+				return err
+			}
+		case c == 'n':
+			if err := s.literal("null"); err != nil {
+				return err
+			}
+		default:
+			if err := s.number(); err != nil {
+				return err
+			}
+		}
+
+		// значение прочитано: закрываем скобки или переходим к следующему элементу
+		for {
+			if len(s.stack) == 0 {
+				return nil
+			}
+			s.skipSpace()
+			closer := s.stack[len(s.stack)-1]
+			if s.consume(closer) {
+				s.stack = s.stack[:len(s.stack)-1]
+				continue
+			}
+			if !s.consume(',') {
+				return s.fail("expected comma or closing bracket")
+			}
+			if closer == '}' {
+				s.skipSpace()
+				if err := s.skipKey(); err != nil {
+					return err
+				}
+			}
+			break
+		}
+	}
+}
+
+func (s *userScanner) skipKey() error {
+	if _, err := s.readString(); err != nil {
+		return err
+	}
+	s.skipSpace()
+	if !s.consume(':') {
+		return s.fail("expected colon after object key")
+	}
+	return nil
+}
+
+func (s *userScanner) literal(word string) error {
+	if len(s.data)-s.pos < len(word) || string(s.data[s.pos:s.pos+len(word)]) != word {
+		return s.fail("invalid literal")
+	}
+	s.pos += len(word)
+	return nil
+}
+
+// number проверяет грамматику -?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?
+func (s *userScanner) number() error {
+	s.consume('-')
+	switch c := s.peek(); {
+	case c == '0':
+		s.pos++
+	case c >= '1' && c <= '9':
+		s.digits()
+	default:
+		return s.fail("invalid character looking for beginning of value")
+	}
+	if s.consume('.') {
+		if !s.digits() {
+			return s.fail("expected digit after decimal point")
+		}
+	}
+	if c := s.peek(); c == 'e' || c == 'E' {
+		s.pos++
+		if c := s.peek(); c == '+' || c == '-' {
+			s.pos++
+		}
+		if !s.digits() {
+			return s.fail("expected digit in exponent")
+		}
+	}
+	return nil
+}
+
+func (s *userScanner) digits() bool {
+	start := s.pos
+	for s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '9' {
+		s.pos++
+	}
+	return s.pos > start
+}
+
+// readString читает строку с кавычками. Если в ней нет escape-последовательностей
+// и битого UTF-8, возвращается кусок data, иначе строка раскодируется в buf.
+func (s *userScanner) readString() (span, error) {
+	if !s.consume('"') {
+		return span{}, s.fail("expected string")
+	}
+	start := s.pos
+	clean := true
+	for {
+		if s.pos >= len(s.data) {
+			return span{}, s.fail("unexpected end of string")
+		}
+		c := s.data[s.pos]
+		switch {
+		case c == '"':
+			raw := span{start: start, end: s.pos}
+			s.pos++
+			if clean {
+				return raw, nil
+			}
+			return s.decode(raw), nil
+		case c < 0x20:
+			return span{}, s.fail("invalid character in string literal")
+		case c == '\\':
+			clean = false
+			s.pos++
+			switch s.peek() {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				s.pos++
+			case 'u':
+				s.pos++
+				if getu4(s.data[s.pos-2:]) < 0 {
+					return span{}, s.fail("invalid \\u escape")
+				}
+				s.pos += 4
+			default:
+				return span{}, s.fail("invalid escape in string literal")
+			}
+		case c < utf8.RuneSelf:
+			s.pos++
+		default:
+			r, size := utf8.DecodeRune(s.data[s.pos:])
+			if r == utf8.RuneError && size == 1 {
+				clean = false
+			}
+			s.pos += size
+		}
+	}
+}
+
+// decode раскодирует проверенную строку так же, как encoding/json
+func (s *userScanner) decode(raw span) span {
+	in := s.data[raw.start:raw.end]
+	start := len(s.buf)
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch {
+		case c == '\\':
+			switch in[i+1] {
+			case 'b':
+				s.buf = append(s.buf, '\b')
+			case 'f':
+				s.buf = append(s.buf, '\f')
+			case 'n':
+				s.buf = append(s.buf, '\n')
+			case 'r':
+				s.buf = append(s.buf, '\r')
+			case 't':
+				s.buf = append(s.buf, '\t')
+			case 'u':
+				r := getu4(in[i:])
+				i += 6
+				if utf16.IsSurrogate(r) {
+					if r2 := utf16.DecodeRune(r, getu4(in[i:])); r2 != unicode.ReplacementChar {
+						r = r2
+						i += 6
+					} else {
+						r = unicode.ReplacementChar
+					}
+				}
+				s.buf = appendRune(s.buf, r)
+				continue
+			default: // " \ /
+				s.buf = append(s.buf, in[i+1])
+			}
+			i += 2
+		case c < utf8.RuneSelf:
+			s.buf = append(s.buf, c)
+			i++
+		default:
+			r, size := utf8.DecodeRune(in[i:])
+			if r == utf8.RuneError && size == 1 {
+				s.buf = appendRune(s.buf, unicode.ReplacementChar)
+			} else {
+				s.buf = append(s.buf, in[i:i+size]...)
+			}
+			i += size
+		}
+	}
+	return span{start: start, end: len(s.buf), decoded: true}
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], r)
+	return append(buf, tmp[:n]...)
+}
+
+// getu4 разбирает \uXXXX в начале b, -1 - если его там нет
+func getu4(b []byte) rune {
+	if len(b) < 6 || b[0] != '\\' || b[1] != 'u' {
+		return -1
+	}
+	var r rune
+	for _, c := range b[2:6] {
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return -1
+		}
+		r = r*16 + rune(c)
+	}
+	return r
+}
+
+func (s *userScanner) bytes(sp span) []byte {
+	if sp.decoded {
+		return s.buf[sp.start:sp.end]
+	}
+	return s.data[sp.start:sp.end]
+}
+
+func (s *userScanner) peek() byte {
+	if s.pos < len(s.data) {
+		return s.data[s.pos]
+	}
+	return 0
+}
+
+func (s *userScanner) consume(c byte) bool {
+	if s.pos < len(s.data) && s.data[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+func (s *userScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// ScanSearch - FastSearch на userScanner вместо easyjson. Битая строка не паникует,
+// а возвращается как *LineError.
+func ScanSearch(out io.Writer) error {
+	return scanSearchFile(out, filePath, Strict, DefaultMasking)
+}
+
+// ScanSearchMode - ScanSearch с выбором режима для битых строк; в Tolerant после
+// итога идёт та же сводка, что у TextFormatter
+func ScanSearchMode(out io.Writer, mode ParseMode) error {
+	return scanSearchFile(out, filePath, mode, DefaultMasking)
+}
+
+// ScanSearchMasked - ScanSearch, который выводит name и email по политикам masking
+func ScanSearchMasked(out io.Writer, masking Masking) error {
+	return scanSearchFile(out, filePath, Strict, masking)
+}
+
+func scanSearchFile(out io.Writer, path string, mode ParseMode, masking Masking) error {
+	file, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+
+	seenBrowsers := make(map[string]struct{}, 1000)
+	var user userScanner
+	bad := badLines{mode: mode}
+
+	writer.WriteString("found users:")
+	writer.WriteByte('\n')
+	scanner := bufio.NewScanner(file)
+	for i := 0; scanner.Scan(); i++ {
+		line := scanner.Bytes()
+		if !bytes.Contains(line, androidByte) && !bytes.Contains(line, msieByte) {
+			continue
+		}
+		if err := user.scan(line); err != nil {
+			if err := bad.add(i, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		isAndroid, isMSIE := false, false
+		for _, browser := range user.Browsers {
+			if bytes.Contains(browser, androidByte) {
+				isAndroid = true
+			} else if bytes.Contains(browser, msieByte) {
+				isMSIE = true
+			} else {
+				continue
+			}
+			// string(browser) в индексе map не аллоцирует
+			if _, ok := seenBrowsers[string(browser)]; !ok {
+				seenBrowsers[string(browser)] = struct{}{}
+			}
+		}
+
+		if isAndroid && isMSIE {
+			writer.WriteRune('[')
+			writer.WriteString(strconv.Itoa(i))
+			writer.WriteRune(']')
+			writer.WriteByte(' ')
+			masking.Name.writeBytes(writer, user.Name)
+			writer.WriteString(" <")
+			masking.Email.writeBytes(writer, user.Email)
+			writer.WriteRune('>')
+			writer.WriteByte('\n')
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	writeTotal(writer, len(seenBrowsers))
+	writeSkipped(writer, bad.skipped, bad.errs)
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"hw3/user"
+
+	"github.com/mailru/easyjson"
+)
+
+func TestScanSearch(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	scanOut := new(bytes.Buffer)
+	if err := ScanSearch(scanOut); err != nil {
+		t.Fatal(err)
+	}
+
+	if scanOut.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", scanOut, fastOut)
+	}
+}
+
+func readLines(tb testing.TB) [][]byte {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bytes.Split(data, []byte("\n"))
+}
+
+// plainUser - user.User без методов easyjson, чтобы json.Unmarshal разбирал его сам
+type plainUser struct {
+	Browsers []string `json:"browsers"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+}
+
+// checkScan сравнивает userScanner с json.Unmarshal
+func checkScan(t *testing.T, s *userScanner, line []byte) {
+	var expected plainUser
+	jsonErr := json.Unmarshal(line, &expected)
+	scanErr := s.scan(line)
+	if (jsonErr == nil) != (scanErr == nil) {
+		t.Fatalf("%q: encoding/json error %v, scanner error %v", line, jsonErr, scanErr)
+	}
+	if jsonErr != nil {
+		return
+	}
+
+	if string(s.Name) != expected.Name || string(s.Email) != expected.Email || len(s.Browsers) != len(expected.Browsers) {
+		t.Fatalf("%q: got name %q, email %q, browsers %q, expected %+v", line, s.Name, s.Email, s.Browsers, expected)
+	}
+	for i, browser := range s.Browsers {
+		if string(browser) != expected.Browsers[i] {
+			t.Fatalf("%q: browser %d: got %q, expected %q", line, i, browser, expected.Browsers[i])
+		}
+	}
+}
+
+var scanCases = []string{
+	`{"browsers":["a","b"],"name":"n","email":"e@x"}`,
+	` { "name" : "n" , "other" : [1, -2.5e+3, {"x": [true, false, null]}, "s\"q"], "email": null } `,
+	`{"NAME":"upper","Email":"mixed","BROWSERS":[]}`,
+	`{"name":"Ж😀\ud83d x\\\/\b\f\n\r\t\"","email":"é"}`,
+	`{"n\u0061me":"escaped key","\u0045MAIL":"k"}`,
+	`{"name":"bad utf8 ` + "\xff\xfe" + `"}`,
+	`{"browsers":["a","b"],"browsers":["c"],"browsers":[null,null,null]}`,
+	`{"browsers":["a"],"browsers":[],"browsers":[null]}`,
+	`{"browsers":["a"],"browsers":null,"browsers":[null]}`,
+	`{"name":"first","name":null}`,
+	`null`,
+	`{}`,
+	`{"name":1}`,
+	`{"browsers":"a"}`,
+	`{"browsers":[1]}`,
+	`{"browsers":[[]]}`,
+	`{"name":"x",}`,
+	`{"name":"x"} x`,
+	`{"name":"x"`,
+	`{"name":"` + "\x01" + `"}`,
+	`{"name":"\x"}`,
+	`{"name":"\u12"}`,
+	`{"other":01}`,
+	`{"other":1.}`,
+	`{"other":-}`,
+	`{"other":1e}`,
+	`{"other":tru}`,
+	`{"other":[1,]}`,
+	`{"other":{"a" 1}}`,
+	`[]`,
+	`"str"`,
+	``,
+}
+
+// глубокая вложенность: граница maxNestingDepth, в корпус фаззера не идут, слишком тяжёлые
+var deepScanCases = []string{
+	`{"other":` + string(bytes.Repeat([]byte("["), 9998)) + string(bytes.Repeat([]byte("]"), 9998)) + `}`,
+	`{"other":` + string(bytes.Repeat([]byte("["), 9999)) + string(bytes.Repeat([]byte("]"), 9999)) + `}`,
+	`{"browsers":[` + string(bytes.Repeat([]byte("["), 9998)) + string(bytes.Repeat([]byte("]"), 9998)) + `]}`,
+}
+
+func TestUserScanner(t *testing.T) {
+	var s userScanner
+	for _, line := range readLines(t) {
+		checkScan(t, &s, line)
+	}
+	for _, line := range scanCases {
+		checkScan(t, &s, []byte(line))
+	}
+	for _, line := range deepScanCases {
+		checkScan(t, &s, []byte(line))
+	}
+}
+
+func TestUserScannerNoAllocs(t *testing.T) {
+	lines := readLines(t)
+	var s userScanner
+	for _, line := range lines {
+		s.scan(line)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		for _, line := range lines {
+			if err := s.scan(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+// go test -fuzz FuzzUserScanner
+func FuzzUserScanner(f *testing.F) {
+	for _, line := range scanCases {
+		f.Add([]byte(line))
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		f.Fatal(err)
+	}
+	scanner := bufio.NewScanner(file)
+	for i := 0; i < 20 && scanner.Scan(); i++ {
+		f.Add(append([]byte(nil), scanner.Bytes()...))
+	}
+	file.Close()
+
+	var s userScanner
+	f.Fuzz(func(t *testing.T, line []byte) {
+		checkScan(t, &s, line)
+	})
+}
+
+func BenchmarkDecodeEasyjson(b *testing.B) {
+	lines := readLines(b)
+	var u user.User
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if err := easyjson.Unmarshal(line, &u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeScanner(b *testing.B) {
+	lines := readLines(b)
+	var s userScanner
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			if err := s.scan(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkScanSearch(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ScanSearch(ioutil.Discard)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: go run . <command> [flags]
+
+commands:
+  generate  write a users.txt-like file sampled from data/users.txt
+  profile   run SlowSearch or FastSearch under cpu, heap, allocs and trace profiles
+  serve     HTTP search over users.txt
+
+"go run . <command> -h" lists the flags of a command`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "generate":
+		err = generateCommand(os.Args[2:])
+	case "profile":
+		err = profileCommand(os.Args[2:])
+	case "serve":
+		err = serveCommand(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// go run . generate -out users-1m.txt -n 1000000 -seed 1
+func generateCommand(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	out := flags.String("out", "users-generated.txt", "output file")
+	lines := flags.Int("n", 100000, "lines")
+	seed := flags.Int64("seed", 1, "random seed, the same seed gives the same file")
+	flags.Parse(args)
+	return GenerateFile(*out, *seed, *lines)
+}
+
+// go run . profile -search fast -n 1000 -dir profile
+func profileCommand(args []string) error {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	opts := ProfileOptions{}
+	flags.StringVar(&opts.Search, "search", "fast", "search to profile: slow or fast")
+	flags.IntVar(&opts.Iterations, "n", 100, "iterations")
+	flags.StringVar(&opts.Dir, "dir", "profile", "directory for cpu.prof, mem.prof, allocs.prof, trace.out and summary.txt")
+	flags.IntVar(&opts.Top, "top", 10, "functions in each summary table")
+	flags.IntVar(&opts.MemProfileRate, "memprofilerate", 0, "runtime.MemProfileRate, 1 records every allocation; 0 keeps the default")
+	flags.Parse(args)
+	return Profile(opts, os.Stdout)
+}
+
+// go run . serve -addr :8080 -data data/users.txt.gz
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "listen address")
+	data := flags.String("data", filePath, "users.txt, plain, gzip or zstd")
+	flags.Parse(args)
+	return ServeSearch(*addr, *data)
+}
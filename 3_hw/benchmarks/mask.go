@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaskPolicy - как выводить персональные данные (name, email) найденных пользователей
+type MaskPolicy int
+
+const (
+	MaskNone    MaskPolicy = iota // как есть
+	MaskAt                        // каждая @ заменяется на " [at] ", как в SlowSearch
+	MaskPartial                   // видны первые два символа до @ и всё после: jo***@domain
+	MaskHash                      // первые 8 байт sha256 в hex: одинаковые значения дают одинаковый хеш
+	MaskRedact                    // [redacted]
+)
+
+var maskPolicyNames = [...]string{"none", "at", "partial", "hash", "redact"}
+
+const (
+	maskAtText   = " [at] "
+	maskStars    = "***"
+	maskRedacted = "[redacted]"
+	maskHashSize = 8
+)
+
+func (p MaskPolicy) String() string {
+	if p < 0 || int(p) >= len(maskPolicyNames) {
+		return fmt.Sprintf("MaskPolicy(%d)", int(p))
+	}
+	return maskPolicyNames[p]
+}
+
+// ParseMaskPolicy - политика по имени: none, at, partial, hash или redact
+func ParseMaskPolicy(name string) (MaskPolicy, error) {
+	for p, n := range maskPolicyNames {
+		if n == name {
+			return MaskPolicy(p), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mask policy %q, expected %s", name, strings.Join(maskPolicyNames[:], ", "))
+}
+
+// Masking - политики для полей вывода
+type Masking struct {
+	Name  MaskPolicy
+	Email MaskPolicy
+}
+
+// DefaultMasking - вывод FastSearch: имя как есть, в email " [at] "
+var DefaultMasking = Masking{Name: MaskNone, Email: MaskAt}
+
+// orDefault - *m или DefaultMasking для nil: умолчание одно для всех форматтеров,
+// без маскирования - это явный &Masking{}
+func (m *Masking) orDefault() Masking {
+	if m == nil {
+		return DefaultMasking
+	}
+	return *m
+}
+
+// user - u с замаскированными полями
+func (m Masking) user(u FoundUser) FoundUser {
+	u.Name, u.Email = m.Name.Apply(u.Name), m.Email.Apply(u.Email)
+	return u
+}
+
+// Apply возвращает s, замаскированную политикой p
+func (p MaskPolicy) Apply(s string) string {
+	switch p {
+	case MaskAt:
+		return strings.ReplaceAll(s, "@", maskAtText)
+	case MaskPartial:
+		end, at := partialSplit(s)
+		return s[:end] + maskStars + s[at:]
+	case MaskHash:
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:maskHashSize])
+	case MaskRedact:
+		return maskRedacted
+	}
+	return s
+}
+
+// write - Apply без промежуточных строк, для горячего пути FastSearch
+func (p MaskPolicy) write(writer *bufio.Writer, s string) {
+	switch p {
+	case MaskAt:
+		for at := strings.IndexByte(s, '@'); at >= 0; at = strings.IndexByte(s, '@') {
+			writer.WriteString(s[:at])
+			writer.WriteString(maskAtText)
+			s = s[at+1:]
+		}
+	case MaskPartial:
+		end, at := partialSplit(s)
+		writer.WriteString(s[:end])
+		writer.WriteString(maskStars)
+		writer.WriteString(s[at:])
+		return
+	case MaskHash:
+		sum := sha256.Sum256([]byte(s))
+		var buf [2 * maskHashSize]byte
+		hex.Encode(buf[:], sum[:maskHashSize])
+		writer.Write(buf[:])
+		return
+	case MaskRedact:
+		writer.WriteString(maskRedacted)
+		return
+	}
+	writer.WriteString(s)
+}
+
+// writeBytes - write для []byte из userScanner: none и at пишут b без копии в
+// строку, остальным политикам строка нужна
+func (p MaskPolicy) writeBytes(writer *bufio.Writer, b []byte) {
+	switch p {
+	case MaskNone:
+		writer.Write(b)
+	case MaskAt:
+		for at := bytes.IndexByte(b, '@'); at >= 0; at = bytes.IndexByte(b, '@') {
+			writer.Write(b[:at])
+			writer.WriteString(maskAtText)
+			b = b[at+1:]
+		}
+		writer.Write(b)
+	default:
+		p.write(writer, string(b))
+	}
+}
+
+// partialSplit - для MaskPartial: s[:end] - первые два символа до @, s[at:] - @ и
+// домен. Битый байт UTF-8 считается символом и выводится как есть, и в Apply, и в write.
+func partialSplit(s string) (end, at int) {
+	at = strings.IndexByte(s, '@')
+	if at < 0 {
+		at = len(s)
+	}
+	for n := 0; n < 2 && end < at; n++ {
+		_, size := utf8.DecodeRuneInString(s[end:at])
+		end += size
+	}
+	return end, at
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+var maskPolicies = []MaskPolicy{MaskNone, MaskAt, MaskPartial, MaskHash, MaskRedact}
+
+func TestMaskPolicy(t *testing.T) {
+	cases := []struct {
+		policy   MaskPolicy
+		in, want string
+	}{
+		{MaskNone, "john@example.com", "john@example.com"},
+		{MaskAt, "john@example.com", "john [at] example.com"},
+		{MaskAt, "John Smith", "John Smith"},
+		{MaskAt, "a@b@c@", "a [at] b [at] c [at] "},
+		{MaskPartial, "john@example.com", "jo***@example.com"},
+		{MaskPartial, "j@example.com", "j***@example.com"},
+		{MaskPartial, "John Smith", "Jo***"},
+		{MaskPartial, "Ёлка", "Ёл***"},
+		{MaskPartial, "", "***"},
+		{MaskPartial, "\xffj\xfe@x", "\xffj***@x"},
+		{MaskPartial, "Ё\xd0", "Ё\xd0***"},
+		{MaskHash, "john@example.com", "855f96e983f1f8e8"},
+		{MaskHash, "", "e3b0c44298fc1c14"},
+		{MaskRedact, "john@example.com", "[redacted]"},
+	}
+	for _, c := range cases {
+		if got := c.policy.Apply(c.in); got != c.want {
+			t.Errorf("%s(%q) = %q, expected %q", c.policy, c.in, got, c.want)
+		}
+		// быстрые варианты пишут то же самое
+		buf := new(bytes.Buffer)
+		writer := bufio.NewWriter(buf)
+		c.policy.write(writer, c.in)
+		writer.Flush()
+		if buf.String() != c.want {
+			t.Errorf("%s(%q) wrote %q, expected %q", c.policy, c.in, buf, c.want)
+		}
+		buf.Reset()
+		c.policy.writeBytes(writer, []byte(c.in))
+		writer.Flush()
+		if buf.String() != c.want {
+			t.Errorf("%s(%q) wrote bytes %q, expected %q", c.policy, c.in, buf, c.want)
+		}
+	}
+
+	for _, p := range maskPolicies {
+		if parsed, err := ParseMaskPolicy(p.String()); err != nil || parsed != p {
+			t.Errorf("%s: parsed as %v, %v", p, parsed, err)
+		}
+	}
+	if _, err := ParseMaskPolicy("xor"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+// TestMaskedSearch - каждая политика даёт одинаковый вывод в SlowSearch, FastSearch, ScanSearch и Search
+func TestMaskedSearch(t *testing.T) {
+	result := searchFile(t, filePath, nil)
+	for _, name := range maskPolicies {
+		for _, email := range maskPolicies {
+			masking := Masking{Name: name, Email: email}
+			label := fmt.Sprintf("name=%s email=%s", name, email)
+
+			slowOut := new(bytes.Buffer)
+			SlowSearchMasked(slowOut, masking)
+			fastOut := new(bytes.Buffer)
+			FastSearchMasked(fastOut, masking)
+			if slowOut.String() != fastOut.String() {
+				t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", label, fastOut, slowOut)
+			}
+			scanOut := new(bytes.Buffer)
+			if err := ScanSearchMasked(scanOut, masking); err != nil {
+				t.Fatal(err)
+			}
+			if slowOut.String() != scanOut.String() {
+				t.Errorf("%s: scan results not match\nGot:\n%v\nExpected:\n%v", label, scanOut, slowOut)
+			}
+
+			out := new(bytes.Buffer)
+			TextFormatter{Masking: &masking}.Format(out, result)
+			if out.String() != slowOut.String() {
+				t.Errorf("%s: formatter results not match\nGot:\n%v\nExpected:\n%v", label, out, slowOut)
+			}
+		}
+	}
+
+	// по умолчанию - прежний вывод
+	slowOut, fastOut := new(bytes.Buffer), new(bytes.Buffer)
+	SlowSearchMasked(slowOut, Masking{Email: MaskAt})
+	FastSearch(fastOut)
+	if slowOut.String() != fastOut.String() {
+		t.Errorf("default masking changed output\nGot:\n%v\nExpected:\n%v", fastOut, slowOut)
+	}
+}
+
+func TestMaskedFormatters(t *testing.T) {
+	result := &SearchResult{Users: []FoundUser{{Index: 3, Name: "Ann Lee", Email: "ann@x.org"}}, UniqueBrowsers: 1}
+	masking := &Masking{Name: MaskPartial, Email: MaskRedact}
+	cases := map[Formatter]string{
+		JSONLinesFormatter{Masking: masking}: `{"index":3,"name":"An***","email":"[redacted]"}` + "\n" + `{"unique_browsers":1}` + "\n",
+		CSVFormatter{Masking: masking}:       "index,name,email\n3,An***,[redacted]\n",
+		// nil - DefaultMasking во всех форматтерах, без маскирования - &Masking{}
+		TextFormatter{}:                         "found users:\n[3] Ann Lee <ann [at] x.org>\n\nTotal unique browsers 1\n",
+		JSONLinesFormatter{}:                    `{"index":3,"name":"Ann Lee","email":"ann [at] x.org"}` + "\n" + `{"unique_browsers":1}` + "\n",
+		CSVFormatter{}:                          "index,name,email\n3,Ann Lee,ann [at] x.org\n",
+		JSONLinesFormatter{Masking: &Masking{}}: `{"index":3,"name":"Ann Lee","email":"ann@x.org"}` + "\n" + `{"unique_browsers":1}` + "\n",
+	}
+	for f, expected := range cases {
+		out := new(bytes.Buffer)
+		if err := f.Format(out, result); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Errorf("%T: got\n%s\nexpected\n%s", f, out, expected)
+		}
+	}
+}
+
+func BenchmarkFastMasked(b *testing.B) {
+	for _, p := range maskPolicies {
+		b.Run(p.String(), func(b *testing.B) {
+			masking := Masking{Name: p, Email: p}
+			for i := 0; i < b.N; i++ {
+				FastSearchMasked(ioutil.Discard, masking)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"hw3/user"
+
+	"github.com/mailru/easyjson"
+)
+
+var errMmapUnsupported = errors.New("mmap is not supported")
+
+// MmapSearch - FastSearch, который на linux читает файл через mmap: строки режутся
+// прямо в отображённой памяти, без копирования в буфер сканера и без лимита в 64KB
+// на строку. Если отобразить файл не вышло - читает буферизованно.
+func MmapSearch(out io.Writer) error {
+	return mmapSearchFile(out, filePath, Strict)
+}
+
+// BufferedSearch - запасной путь MmapSearch: bufio.Reader без ограничения на длину строки
+func BufferedSearch(out io.Writer) error {
+	return bufferedSearchFile(out, filePath, Strict)
+}
+
+// TolerantSearch - MmapSearch, который не останавливается на битых строках, а
+// пропускает их и после Total unique browsers печатает, какие и почему.
+// Разбираются, а значит проверяются, только строки с Android или MSIE.
+func TolerantSearch(out io.Writer) error {
+	return mmapSearchFile(out, filePath, Tolerant)
+}
+
+func mmapSearchFile(out io.Writer, path string, mode ParseMode) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, unmap, err := mapFile(file)
+	if err != nil {
+		return searchReader(out, file, mode)
+	}
+	defer unmap()
+
+	if compression(data) != "" {
+		// сжатое всё равно придётся распаковывать в буфер
+		return searchReader(out, bytes.NewReader(data), mode)
+	}
+	return searchMapped(out, data, mode)
+}
+
+func bufferedSearchFile(out io.Writer, path string, mode ParseMode) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return searchReader(out, file, mode)
+}
+
+// searchReader - searchLines по r, распакованному при необходимости
+func searchReader(out io.Writer, r io.Reader, mode ParseMode) error {
+	input, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	return searchLines(out, input, mode)
+}
+
+func searchMapped(out io.Writer, data []byte, mode ParseMode) error {
+	search := newFastLines(out, mode)
+	for i := 0; len(data) > 0; i++ {
+		line := data
+		if end := bytes.IndexByte(data, '\n'); end >= 0 {
+			line, data = data[:end], data[end+1:]
+		} else {
+			data = nil
+		}
+		if err := search.line(i, line); err != nil {
+			return err
+		}
+	}
+	return search.finish()
+}
+
+func searchLines(out io.Writer, r io.Reader, mode ParseMode) error {
+	search := newFastLines(out, mode)
+	reader := bufio.NewReader(r)
+	var long []byte
+	for i := 0; ; {
+		chunk, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// строка длиннее буфера ридера: собираем её по кускам
+			long = append(long, chunk...)
+			continue
+		}
+		line := chunk
+		if len(long) > 0 {
+			long = append(long, chunk...)
+			line = long
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		if len(line) > 0 || err == nil {
+			if lineErr := search.line(i, line); lineErr != nil {
+				return lineErr
+			}
+			i++
+		}
+		long = long[:0]
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return search.finish()
+}
+
+// fastLines - тело цикла FastSearch
+type fastLines struct {
+	writer       *bufio.Writer
+	seenBrowsers map[string]struct{}
+	user         user.User
+	bad          badLines
+}
+
+func newFastLines(out io.Writer, mode ParseMode) *fastLines {
+	s := &fastLines{
+		writer:       bufio.NewWriter(out),
+		seenBrowsers: make(map[string]struct{}, 1000),
+		bad:          badLines{mode: mode},
+	}
+	s.writer.WriteString("found users:")
+	s.writer.WriteByte('\n')
+	return s
+}
+
+func (s *fastLines) line(i int, line []byte) error {
+	if !bytes.Contains(line, androidByte) && !bytes.Contains(line, msieByte) {
+		return nil
+	}
+
+	s.user = user.User{Browsers: s.user.Browsers[:0]}
+	if err := easyjson.Unmarshal(line, &s.user); err != nil {
+		return s.bad.add(i, err)
+	}
+
+	isAndroid, isMSIE := false, false
+	for _, browser := range s.user.Browsers {
+		if strings.Contains(browser, android) {
+			isAndroid = true
+			s.seenBrowsers[browser] = struct{}{}
+		} else if strings.Contains(browser, msie) {
+			isMSIE = true
+			s.seenBrowsers[browser] = struct{}{}
+		}
+	}
+
+	if isAndroid && isMSIE {
+		writeFoundUser(s.writer, i, s.user.Name, s.user.Email, DefaultMasking)
+	}
+	return nil
+}
+
+func (s *fastLines) finish() error {
+	writeTotal(s.writer, len(s.seenBrowsers))
+	writeSkipped(s.writer, s.bad.skipped, s.bad.errs)
+	return s.writer.Flush()
+}
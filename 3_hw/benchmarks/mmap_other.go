@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "os"
+
+func mapFile(file *os.File) ([]byte, func() error, error) {
+	return nil, nil, errMmapUnsupported
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMmapSearch(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	for name, search := range map[string]func(*bytes.Buffer) error{
+		"mmap":     func(out *bytes.Buffer) error { return MmapSearch(out) },
+		"buffered": func(out *bytes.Buffer) error { return BufferedSearch(out) },
+	} {
+		out := new(bytes.Buffer)
+		if err := search(out); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != fastOut.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out, fastOut)
+		}
+	}
+}
+
+func TestMmapSearchLongLines(t *testing.T) {
+	// строка больше 64KB, на которой bufio.Scanner останавливается, и перевод строки в конце
+	long := `{"browsers":["Android","MSIE"],"name":"long","email":"l@x","job":"` + strings.Repeat("x", 200000) + `"}`
+	data := strings.Join([]string{
+		`{"browsers":["MSIE"],"name":"a","email":"a@x"}`,
+		long,
+		`{"browsers":["Android 4","MSIE 10"],"name":"c","email":"c@x"}`,
+		``,
+	}, "\n")
+	expected := "found users:\n[1] long <l [at] x>\n[2] c <c [at] x>\n\nTotal unique browsers 4\n"
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.txt")
+	empty := filepath.Join(dir, "empty.txt")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, search := range map[string]func(*bytes.Buffer, string) error{
+		"mmap":     func(out *bytes.Buffer, path string) error { return mmapSearchFile(out, path, Strict) },
+		"buffered": func(out *bytes.Buffer, path string) error { return bufferedSearchFile(out, path, Strict) },
+	} {
+		out := new(bytes.Buffer)
+		if err := search(out, path); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != expected {
+			t.Errorf("%s: got\n%v", name, out)
+		}
+
+		out.Reset()
+		if err := search(out, empty); err != nil {
+			t.Fatalf("%s, empty file: %v", name, err)
+		}
+		if out.String() != "found users:\n\nTotal unique browsers 0\n" {
+			t.Errorf("%s, empty file: got\n%v", name, out)
+		}
+	}
+}
+
+// TestTolerantSearch - быстрый путь пропускает те же строки, что и SearchMode
+func TestTolerantSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, []byte(badInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := SearchMode(strings.NewReader(badInput), nil, Tolerant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := new(bytes.Buffer)
+	TextFormatter{}.Format(expected, result)
+
+	for name, search := range map[string]func(*bytes.Buffer, string, ParseMode) error{
+		"mmap":     func(out *bytes.Buffer, path string, mode ParseMode) error { return mmapSearchFile(out, path, mode) },
+		"buffered": func(out *bytes.Buffer, path string, mode ParseMode) error { return bufferedSearchFile(out, path, mode) },
+	} {
+		out := new(bytes.Buffer)
+		if err := search(out, path, Tolerant); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != expected.String() {
+			t.Errorf("%s: got\n%v\nexpected\n%v", name, out, expected)
+		}
+		var lineErr *LineError
+		if err := search(new(bytes.Buffer), path, Strict); !errors.As(err, &lineErr) || lineErr.Line != 1 {
+			t.Errorf("%s: expected error on line 1 in strict mode, got %v", name, err)
+		}
+	}
+
+	// на чистом файле вывод тот же, что у FastSearch
+	fastOut, out := new(bytes.Buffer), new(bytes.Buffer)
+	FastSearch(fastOut)
+	if err := TolerantSearch(out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+}
+
+func BenchmarkMmap(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		MmapSearch(ioutil.Discard)
+	}
+}
+
+func BenchmarkBuffered(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		BufferedSearch(ioutil.Discard)
+	}
+}
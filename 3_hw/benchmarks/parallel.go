@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"hw3/user"
+)
+
+// ParallelSearch - QuerySearch, который режет файл на куски по границам строк
+// и разбирает их на workers ядрах (0 - на всех). Вывод такой же, как у QuerySearch.
+func ParallelSearch(out io.Writer, q *Query, workers int) error {
+	return parallelSearchFile(out, filePath, q, workers, Strict)
+}
+
+// ParallelSearchMode - ParallelSearch с выбором режима для битых строк
+func ParallelSearchMode(out io.Writer, q *Query, workers int, mode ParseMode) error {
+	return parallelSearchFile(out, filePath, q, workers, mode)
+}
+
+type chunkResult struct {
+	lines        int
+	found        []FoundUser // Index - номер строки внутри куска
+	seenBrowsers map[string]struct{}
+	bad          badLines // Line - тоже внутри куска
+	err          error
+}
+
+func parallelSearchFile(out io.Writer, path string, q *Query, workers int, mode ParseMode) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	kind, err := fileCompression(file)
+	if err != nil {
+		return err
+	}
+	if kind != "" {
+		// в сжатом файле нельзя начать с середины, ищем одним проходом
+		return compressedSearch(out, file, q, mode)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	offsets, err := splitLines(file, info.Size(), workers)
+	if err != nil {
+		return err
+	}
+
+	results := make([]chunkResult, len(offsets)-1)
+	wg := &sync.WaitGroup{}
+	for n := range results {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			results[n] = searchChunk(io.NewSectionReader(file, offsets[n], offsets[n+1]-offsets[n]), q, mode)
+		}(n)
+	}
+	wg.Wait()
+
+	merged := &SearchResult{}
+	seenBrowsers := make(map[string]struct{}, 1000)
+	for _, result := range results {
+		if lineErr, ok := result.err.(*LineError); ok {
+			lineErr.Line += merged.Lines
+		}
+		if result.err != nil {
+			return result.err
+		}
+		for _, u := range result.found {
+			u.Index += merged.Lines
+			merged.Users = append(merged.Users, u)
+		}
+		for browser := range result.seenBrowsers {
+			seenBrowsers[browser] = struct{}{}
+		}
+		for _, lineErr := range result.bad.errs {
+			if len(merged.BadLines) == maxBadLines {
+				break
+			}
+			lineErr.Line += merged.Lines
+			merged.BadLines = append(merged.BadLines, lineErr)
+		}
+		merged.Skipped += result.bad.skipped
+		merged.Lines += result.lines
+	}
+	merged.UniqueBrowsers = len(seenBrowsers)
+	return TextFormatter{}.Format(out, merged)
+}
+
+func compressedSearch(out io.Writer, r io.Reader, q *Query, mode ParseMode) error {
+	input, err := Decompress(r)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	result, err := SearchMode(input, q, mode)
+	if err != nil {
+		return err
+	}
+	return TextFormatter{}.Format(out, result)
+}
+
+func searchChunk(r io.Reader, q *Query, mode ParseMode) chunkResult {
+	var result chunkResult
+	search := newQueryScan(q)
+	search.bad.mode = mode
+	result.lines, result.err = search.scan(r, func(i int, record *user.Record) {
+		result.found = append(result.found, FoundUser{Index: i, Name: record.Name, Email: record.Email})
+	})
+	result.seenBrowsers = search.seenBrowsers
+	result.bad = search.bad
+	return result
+}
+
+// splitLines делит [0, size) на n примерно равных кусков, сдвигая каждую границу
+// на начало следующей строки. Возвращает границы: offsets[0] = 0, последняя = size;
+// совпавшие границы (строк меньше, чем кусков, или строки длинные) выкидываются.
+func splitLines(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	offsets := []int64{0}
+	for k := 1; k < n; k++ {
+		start, err := nextLine(r, size*int64(k)/int64(n), size)
+		if err != nil {
+			return nil, err
+		}
+		if start > offsets[len(offsets)-1] && start < size {
+			offsets = append(offsets, start)
+		}
+	}
+	return append(offsets, size), nil
+}
+
+// nextLine - начало первой строки, которая начинается не раньше pos
+func nextLine(r io.ReaderAt, pos, size int64) (int64, error) {
+	if pos == 0 {
+		return 0, nil
+	}
+	// с pos-1: если там '\n', то строка начинается ровно в pos
+	buf := make([]byte, 4096)
+	for off := pos - 1; off < size; off += int64(len(buf)) {
+		n, err := r.ReadAt(buf, off)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return off + int64(i) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return size, nil
+}
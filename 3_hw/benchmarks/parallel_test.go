@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParallelSearch(t *testing.T) {
+	for _, query := range []string{DefaultQuery, `browsers has "Android" and country = "Kenya"`, `email has ".edu"`} {
+		q := MustCompileQuery(query)
+		expected := new(bytes.Buffer)
+		if err := QuerySearch(expected, q); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, workers := range []int{1, 2, 3, 7, 64, 5000} {
+			out := new(bytes.Buffer)
+			if err := ParallelSearch(out, q, workers); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("%s, %d workers: results not match\nGot:\n%v\nExpected:\n%v", query, workers, out, expected)
+			}
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	data := "a\nbb\n\nccc\ndddddddddd\ne\n"
+	for n := 1; n <= len(data)+1; n++ {
+		offsets, err := splitLines(strings.NewReader(data), int64(len(data)), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offsets[0] != 0 || offsets[len(offsets)-1] != int64(len(data)) {
+			t.Fatalf("n=%d: bad bounds %v", n, offsets)
+		}
+		var parts []string
+		for k := 1; k < len(offsets); k++ {
+			if offsets[k] <= offsets[k-1] || data[offsets[k]-1] != '\n' {
+				t.Fatalf("n=%d: bad offsets %v", n, offsets)
+			}
+			parts = append(parts, data[offsets[k-1]:offsets[k]])
+		}
+		if strings.Join(parts, "") != data {
+			t.Errorf("n=%d: chunks %q", n, parts)
+		}
+	}
+}
+
+func TestParallelSearchLineNumbers(t *testing.T) {
+	// без перевода строки в конце и с длинными строками, на которых границы кусков совпадают
+	lines := []string{
+		`{"browsers":["MSIE"],"name":"a","email":"a@x"}`,
+		`{"browsers":["Android","MSIE"],"name":"b","email":"b@x","job":"` + strings.Repeat("x", 10000) + `"}`,
+		`{"browsers":[],"name":"c","email":"c@x"}`,
+		`{"browsers":["Android MSIE"],"name":"d","email":"d@x"}`,
+	}
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "found users:\n[1] b <b [at] x>\n[3] d <d [at] x>\n\nTotal unique browsers 3\n"
+	for _, workers := range []int{1, 2, 4, 100} {
+		out := new(bytes.Buffer)
+		if err := parallelSearchFile(out, path, MustCompileQuery(DefaultQuery), workers, Strict); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Errorf("%d workers: got\n%v", workers, out)
+		}
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	q := MustCompileQuery(DefaultQuery)
+	for i := 0; i < b.N; i++ {
+		ParallelSearch(ioutil.Discard, q, runtime.NumCPU())
+	}
+}
+
+func TestParallelSearchLineError(t *testing.T) {
+	lines := []string{
+		`{"browsers":["MSIE"],"name":"a","email":"a@x"}`,
+		`{"browsers":["MSIE"],"name":"b","email":"b@x"}`,
+		`{"browsers":["MSIE"],"name":"c","email":"c@x"}`,
+		`{"browsers":["MSIE"],"name":`,
+	}
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 2, 4} {
+		err := parallelSearchFile(ioutil.Discard, path, MustCompileQuery(DefaultQuery), workers, Strict)
+		var lineErr *LineError
+		if !errors.As(err, &lineErr) || lineErr.Line != 3 {
+			t.Errorf("%d workers: expected error on line 3, got %v", workers, err)
+		}
+	}
+}
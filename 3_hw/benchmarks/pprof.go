@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+)
+
+// stackProfile - профиль, сведённый к тому, что нужно topFunctions: типы
+// значений и сэмплы со стеками из имён функций
+type stackProfile struct {
+	sampleTypes []sampleType
+	samples     []stackSample
+}
+
+type sampleType struct {
+	typ, unit string
+}
+
+type stackSample struct {
+	values []int64
+	// stack[0] - вершина стека; у адреса несколько функций, если в него
+	// встроены другие, первая - самая глубокая из встроенных
+	stack [][]string
+}
+
+var errBadProfile = errors.New("profile: malformed protobuf")
+
+// parseProfile читает профиль в формате profile.proto, как его пишет runtime/pprof
+// (gzip или без сжатия). Разбираются только типы значений, сэмплы, адреса и
+// имена функций.
+func parseProfile(r io.Reader) (*stackProfile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(gz); err != nil {
+			return nil, err
+		}
+	}
+
+	type rawSample struct {
+		locations []uint64
+		values    []int64
+	}
+	var (
+		strs      []string
+		types     [][2]uint64 // индексы type и unit в strs
+		samples   []rawSample
+		locations = map[uint64][]uint64{} // адрес -> функции
+		functions = map[uint64]uint64{}   // функция -> индекс имени в strs
+	)
+	err = protoFields(data, func(num int, wire int, v uint64, msg []byte) error {
+		switch {
+		case num == 1 && wire == 2: // sample_type
+			var t [2]uint64
+			err := protoFields(msg, func(num int, wire int, v uint64, _ []byte) error {
+				if (num == 1 || num == 2) && wire == 0 {
+					t[num-1] = v
+				}
+				return nil
+			})
+			types = append(types, t)
+			return err
+		case num == 2 && wire == 2: // sample
+			var s rawSample
+			err := protoFields(msg, func(num int, wire int, v uint64, packed []byte) error {
+				switch num {
+				case 1:
+					return protoUints(wire, v, packed, func(v uint64) { s.locations = append(s.locations, v) })
+				case 2:
+					return protoUints(wire, v, packed, func(v uint64) { s.values = append(s.values, int64(v)) })
+				}
+				return nil
+			})
+			samples = append(samples, s)
+			return err
+		case num == 4 && wire == 2: // location
+			var id uint64
+			var funcs []uint64
+			err := protoFields(msg, func(num int, wire int, v uint64, line []byte) error {
+				switch {
+				case num == 1 && wire == 0:
+					id = v
+				case num == 4 && wire == 2:
+					return protoFields(line, func(num int, wire int, v uint64, _ []byte) error {
+						if num == 1 && wire == 0 {
+							funcs = append(funcs, v)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			locations[id] = funcs
+			return err
+		case num == 5 && wire == 2: // function
+			var id, name uint64
+			err := protoFields(msg, func(num int, wire int, v uint64, _ []byte) error {
+				switch {
+				case num == 1 && wire == 0:
+					id = v
+				case num == 2 && wire == 0:
+					name = v
+				}
+				return nil
+			})
+			functions[id] = name
+			return err
+		case num == 6 && wire == 2: // string_table
+			strs = append(strs, string(msg))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	str := func(i uint64) (string, error) {
+		if i >= uint64(len(strs)) {
+			return "", errBadProfile
+		}
+		return strs[i], nil
+	}
+	p := &stackProfile{}
+	for _, t := range types {
+		typ, err := str(t[0])
+		if err != nil {
+			return nil, err
+		}
+		unit, err := str(t[1])
+		if err != nil {
+			return nil, err
+		}
+		p.sampleTypes = append(p.sampleTypes, sampleType{typ: typ, unit: unit})
+	}
+	for _, s := range samples {
+		if len(s.values) != len(p.sampleTypes) {
+			return nil, errBadProfile
+		}
+		sample := stackSample{values: s.values}
+		for _, loc := range s.locations {
+			funcs, ok := locations[loc]
+			if !ok {
+				return nil, errBadProfile
+			}
+			names := make([]string, 0, len(funcs))
+			for _, fn := range funcs {
+				name, err := str(functions[fn])
+				if err != nil {
+					return nil, err
+				}
+				names = append(names, name)
+			}
+			sample.stack = append(sample.stack, names)
+		}
+		p.samples = append(p.samples, sample)
+	}
+	return p, nil
+}
+
+// protoFields вызывает f для каждого поля сообщения: v - значение varint,
+// msg - содержимое поля с длиной (wire 2); поля fixed32 и fixed64 пропускаются
+func protoFields(data []byte, f func(num int, wire int, v uint64, msg []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errBadProfile
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+		var v uint64
+		var msg []byte
+		switch wire {
+		case 0:
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return errBadProfile
+			}
+			data = data[n:]
+		case 1, 5:
+			size := 8
+			if wire == 5 {
+				size = 4
+			}
+			if len(data) < size {
+				return errBadProfile
+			}
+			data = data[size:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errBadProfile
+			}
+			msg, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return errBadProfile
+		}
+		if err := f(num, wire, v, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoUints - повторяющееся числовое поле: одно значение (wire 0) или упакованные (wire 2)
+func protoUints(wire int, v uint64, packed []byte, add func(uint64)) error {
+	if wire == 0 {
+		add(v)
+		return nil
+	}
+	for len(packed) > 0 {
+		v, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return errBadProfile
+		}
+		add(v)
+		packed = packed[n:]
+	}
+	return nil
+}
+
+// memProfile - runtime.MemProfile на момент последней сборки мусора, со всеми записями
+func memProfile() []runtime.MemProfileRecord {
+	n, _ := runtime.MemProfile(nil, true)
+	for {
+		records := make([]runtime.MemProfileRecord, n+50)
+		var ok bool
+		if n, ok = runtime.MemProfile(records, true); ok {
+			return records[:n]
+		}
+	}
+}
+
+// allocsSince - аллокации между снимками before и after как профиль с
+// alloc_objects и alloc_space. rate - MemProfileRate, с которым они записаны:
+// при rate > 1 записана только часть аллокаций, и значения масштабируются, как в runtime/pprof.
+func allocsSince(before, after []runtime.MemProfileRecord, rate int) *stackProfile {
+	base := make(map[[32]uintptr]runtime.MemProfileRecord, len(before))
+	for _, r := range before {
+		base[r.Stack0] = r
+	}
+	p := &stackProfile{sampleTypes: []sampleType{{"alloc_objects", "count"}, {"alloc_space", "bytes"}}}
+	for _, r := range after {
+		old := base[r.Stack0]
+		objects, bytes := scaleAllocs(r.AllocObjects-old.AllocObjects, r.AllocBytes-old.AllocBytes, rate)
+		if objects == 0 {
+			continue
+		}
+		p.samples = append(p.samples, stackSample{values: []int64{objects, bytes}, stack: symbolize(r.Stack())})
+	}
+	return p
+}
+
+// scaleAllocs - оценка числа и объёма аллокаций по записанным, как scaleHeapSample в runtime/pprof
+func scaleAllocs(objects, bytes int64, rate int) (int64, int64) {
+	if objects <= 0 || bytes <= 0 || rate <= 1 {
+		return objects, bytes
+	}
+	scale := 1 / (1 - math.Exp(-float64(bytes)/float64(objects)/float64(rate)))
+	return int64(float64(objects) * scale), int64(float64(bytes) * scale)
+}
+
+// symbolize - имена функций по адресам стека. Адреса внутри runtime на вершине
+// (mallocgc и т.п.) отбрасываются, как в профилях runtime/pprof.
+func symbolize(stack []uintptr) [][]string {
+	names := make([][]string, 0, len(stack))
+	for _, pc := range stack {
+		var funcs []string
+		frames := runtime.CallersFrames([]uintptr{pc})
+		for {
+			frame, more := frames.Next()
+			funcs = append(funcs, frame.Function)
+			if !more {
+				break
+			}
+		}
+		names = append(names, funcs)
+	}
+	// последняя функция адреса - та, в которую встроены остальные
+	for len(names) > 1 && isRuntimeFunc(names[0][len(names[0])-1]) {
+		names = names[1:]
+	}
+	return names
+}
+
+func isRuntimeFunc(name string) bool {
+	return strings.HasPrefix(name, "runtime.") || strings.HasPrefix(name, "internal/runtime/")
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// ProfileOptions - что профилировать и куда писать
+type ProfileOptions struct {
+	Search         string // slow или fast
+	Iterations     int
+	Dir            string
+	Top            int // сколько функций в таблицах сводки
+	MemProfileRate int // runtime.MemProfileRate на время прогона, 0 - не менять
+}
+
+var profileSearches = map[string]func(io.Writer){
+	"slow": SlowSearch,
+	"fast": FastSearch,
+}
+
+// Файлы, которые пишет Profile; cpu.prof и mem.prof - те же, что в report.md.
+// allocs.prof считает аллокации с начала процесса, allocs_base.prof - снимок
+// перед прогоном для go tool pprof -diff_base.
+const (
+	cpuProfileFile        = "cpu.prof"
+	heapProfileFile       = "mem.prof"
+	allocsProfileFile     = "allocs.prof"
+	allocsBaseProfileFile = "allocs_base.prof"
+	traceFile             = "trace.out"
+	summaryFile           = "summary.txt"
+)
+
+// Profile прогоняет поиск по opts.Iterations раз для профилей heap и allocs,
+// под CPU-профилем и под trace и пишет сводку: ns/op, B/op, allocs/op, как у
+// go test -benchmem, и самые тяжёлые функции. Сводка пишется и в summary.txt, и в w.
+func Profile(opts ProfileOptions, w io.Writer) error {
+	search, ok := profileSearches[opts.Search]
+	if !ok {
+		return fmt.Errorf("unknown search %q, expected slow or fast", opts.Search)
+	}
+	if opts.Iterations <= 0 {
+		return errors.New("iterations must be > 0")
+	}
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return err
+	}
+	// первый прогон - чтобы файл попал в кеш, как init в main_test.go
+	search(io.Discard)
+
+	allocs, err := profileMemory(opts, search)
+	if err != nil {
+		return err
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	elapsed, err := profileCPU(filepath.Join(opts.Dir, cpuProfileFile), search, opts.Iterations)
+	if err != nil {
+		return err
+	}
+	runtime.ReadMemStats(&after)
+
+	if err := traceSearch(filepath.Join(opts.Dir, traceFile), search, opts.Iterations); err != nil {
+		return err
+	}
+
+	summary := new(bytes.Buffer)
+	n := uint64(opts.Iterations)
+	fmt.Fprintf(summary, "%s search, %d iterations\n", opts.Search, opts.Iterations)
+	fmt.Fprintf(summary, "%d ns/op\t%d B/op\t%d allocs/op\n",
+		elapsed.Nanoseconds()/int64(opts.Iterations), (after.TotalAlloc-before.TotalAlloc)/n, (after.Mallocs-before.Mallocs)/n)
+
+	cpu, err := readProfile(filepath.Join(opts.Dir, cpuProfileFile))
+	if err != nil {
+		return err
+	}
+	tables := []struct {
+		p             *stackProfile
+		sample, title string
+	}{
+		{cpu, "cpu", "CPU"},
+		{allocs, "alloc_space", "allocated bytes"},
+		{allocs, "alloc_objects", "allocated objects"},
+	}
+	for _, t := range tables {
+		if err := writeTopFunctions(summary, t.p, t.sample, t.title, opts.Top); err != nil {
+			return fmt.Errorf("%s: %v", t.title, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(opts.Dir, summaryFile), summary.Bytes(), 0644); err != nil {
+		return err
+	}
+	_, err = w.Write(summary.Bytes())
+	return err
+}
+
+// profileMemory - отдельный прогон для heap и allocs: с MemProfileRate = 1 каждая
+// аллокация снимает стек, и в CPU-профиле была бы одна раскрутка стека.
+// Возвращает аллокации только этого прогона, без прогрева и всего, что было до него.
+func profileMemory(opts ProfileOptions, search func(io.Writer)) (*stackProfile, error) {
+	if opts.MemProfileRate > 0 {
+		defer func(rate int) { runtime.MemProfileRate = rate }(runtime.MemProfileRate)
+		runtime.MemProfileRate = opts.MemProfileRate
+	}
+	// профили памяти - на момент последней сборки мусора
+	runtime.GC()
+	if err := writeProfile(filepath.Join(opts.Dir, allocsBaseProfileFile), "allocs"); err != nil {
+		return nil, err
+	}
+	runtime.GC()
+	before := memProfile()
+	for i := 0; i < opts.Iterations; i++ {
+		search(io.Discard)
+	}
+	runtime.GC()
+	after := memProfile()
+	for name, file := range map[string]string{"heap": heapProfileFile, "allocs": allocsProfileFile} {
+		if err := writeProfile(filepath.Join(opts.Dir, file), name); err != nil {
+			return nil, err
+		}
+	}
+	return allocsSince(before, after, runtime.MemProfileRate), nil
+}
+
+func profileCPU(path string, search func(io.Writer), iterations int) (time.Duration, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if err := pprof.StartCPUProfile(file); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		search(io.Discard)
+	}
+	elapsed := time.Since(start)
+	pprof.StopCPUProfile()
+	return elapsed, file.Close()
+}
+
+// traceSearch - отдельный прогон: trace замедляет поиск и испортил бы CPU-профиль
+func traceSearch(path string, search func(io.Writer), iterations int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := trace.Start(file); err != nil {
+		return err
+	}
+	for i := 0; i < iterations; i++ {
+		search(io.Discard)
+	}
+	trace.Stop()
+	return file.Close()
+}
+
+func writeProfile(path, name string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(file, 0); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readProfile(path string) (*stackProfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseProfile(file)
+}
+
+// funcStat - строка pprof top: flat - в самой функции, cum - вместе с вызванными
+type funcStat struct {
+	name      string
+	flat, cum int64
+}
+
+// topFunctions - функции по убыванию flat, как pprof top, и сумма sample по профилю
+func topFunctions(p *stackProfile, sample string) ([]funcStat, int64, error) {
+	index := -1
+	for i, st := range p.sampleTypes {
+		if st.typ == sample {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, 0, fmt.Errorf("no %s samples in profile", sample)
+	}
+
+	stats := map[string]*funcStat{}
+	stat := func(name string) *funcStat {
+		s, ok := stats[name]
+		if !ok {
+			s = &funcStat{name: name}
+			stats[name] = s
+		}
+		return s
+	}
+
+	var total int64
+	for _, s := range p.samples {
+		value := s.values[index]
+		total += value
+		// в рекурсии функция встречается в стеке несколько раз, cum считаем один раз
+		seen := map[string]bool{}
+		for i, funcs := range s.stack {
+			// funcs[0] - самая глубокая из встроенных функций
+			for j, name := range funcs {
+				if i == 0 && j == 0 {
+					stat(name).flat += value
+				}
+				if !seen[name] {
+					seen[name] = true
+					stat(name).cum += value
+				}
+			}
+		}
+	}
+
+	top := make([]funcStat, 0, len(stats))
+	for _, s := range stats {
+		top = append(top, *s)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].flat != top[j].flat {
+			return top[i].flat > top[j].flat
+		}
+		if top[i].cum != top[j].cum {
+			return top[i].cum > top[j].cum
+		}
+		return top[i].name < top[j].name
+	})
+	return top, total, nil
+}
+
+func writeTopFunctions(w io.Writer, p *stackProfile, sample, title string, n int) error {
+	top, total, err := topFunctions(p, sample)
+	if err != nil {
+		return err
+	}
+	unit := ""
+	for _, st := range p.sampleTypes {
+		if st.typ == sample {
+			unit = st.unit
+		}
+	}
+	if len(top) > n {
+		top = top[:n]
+	}
+
+	fmt.Fprintf(w, "\n%s, total %s, top %d by flat:\n", title, formatSample(total, unit), len(top))
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "flat\tflat%\tcum\tcum%\t")
+	for _, s := range top {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t  %s\n",
+			formatSample(s.flat, unit), percent(s.flat, total), formatSample(s.cum, unit), percent(s.cum, total), s.name)
+	}
+	return table.Flush()
+}
+
+func formatSample(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Millisecond).String()
+	case "bytes":
+		switch {
+		case v >= 1<<20:
+			return fmt.Sprintf("%.2fMB", float64(v)/(1<<20))
+		case v >= 1<<10:
+			return fmt.Sprintf("%.2fkB", float64(v)/(1<<10))
+		}
+		return fmt.Sprintf("%dB", v)
+	}
+	return fmt.Sprint(v)
+}
+
+func percent(v, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(v)*100/float64(total))
+}
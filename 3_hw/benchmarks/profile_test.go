@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profile")
+	out := new(bytes.Buffer)
+	opts := ProfileOptions{Search: "fast", Iterations: 3, Dir: dir, Top: 5, MemProfileRate: 1}
+	if err := Profile(opts, out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{cpuProfileFile, heapProfileFile, allocsProfileFile, allocsBaseProfileFile} {
+		if _, err := readProfile(filepath.Join(dir, file)); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+	if _, err := parseProfile(strings.NewReader("\x0a\x05\x08")); err != errBadProfile {
+		t.Errorf("truncated profile: got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, traceFile)); err != nil || info.Size() == 0 {
+		t.Errorf("%s: %v", traceFile, err)
+	}
+	summary, err := os.ReadFile(filepath.Join(dir, summaryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(summary) != out.String() {
+		t.Error("summary.txt differs from the output")
+	}
+
+	// по числу объектов jlexer всегда в первой пятёрке
+	for _, part := range []string{"fast search, 3 iterations\n", " allocs/op\n", "\nCPU, total ", "\nallocated bytes, total ",
+		"\nallocated objects, total ", "easyjson/jlexer.(*Lexer).String\n"} {
+		if !strings.Contains(out.String(), part) {
+			t.Errorf("no %q in summary:\n%s", part, out)
+		}
+	}
+
+	// в таблицах аллокаций - только прогон, без прогрева и остальных тестов:
+	// с MemProfileRate = 1 объектов столько же, сколько allocs/op на итерацию
+	var allocsPerOp, objects int
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 6 && fields[5] == "allocs/op" {
+			allocsPerOp, _ = strconv.Atoi(fields[4])
+		}
+		fmt.Sscanf(line, "allocated objects, total %d,", &objects)
+	}
+	if allocsPerOp == 0 || objects < 3*allocsPerOp*9/10 || objects > 3*allocsPerOp*11/10 {
+		t.Errorf("%d objects allocated in 3 iterations, %d allocs/op", objects, allocsPerOp)
+	}
+
+	for _, bad := range []ProfileOptions{{Search: "medium", Iterations: 1, Dir: dir}, {Search: "slow", Dir: dir}} {
+		if err := Profile(bad, new(bytes.Buffer)); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
+
+func TestTopFunctions(t *testing.T) {
+	p := &stackProfile{
+		sampleTypes: []sampleType{{"samples", "count"}, {"cpu", "nanoseconds"}},
+		samples: []stackSample{
+			// parse встроена в search, search рекурсивно вызывает себя
+			{values: []int64{1, 30e6}, stack: [][]string{{"parse", "search"}, {"search"}, {"main"}}},
+			{values: []int64{1, 20e6}, stack: [][]string{{"search"}, {"main"}}},
+			{values: []int64{1, 50e6}, stack: [][]string{{"gc"}}},
+		},
+	}
+
+	top, total, err := topFunctions(p, "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []funcStat{{"gc", 50e6, 50e6}, {"parse", 30e6, 30e6}, {"search", 20e6, 50e6}, {"main", 0, 50e6}}
+	if total != 100e6 || len(top) != len(expected) {
+		t.Fatalf("got %+v, total %d", top, total)
+	}
+	for i := range expected {
+		if top[i] != expected[i] {
+			t.Errorf("%d: got %+v, expected %+v", i, top[i], expected[i])
+		}
+	}
+
+	if _, _, err := topFunctions(p, "alloc_space"); err == nil {
+		t.Error("expected error for missing sample type")
+	}
+	out := new(bytes.Buffer)
+	if err := writeTopFunctions(out, p, "cpu", "CPU", 2); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "\nCPU, total 100ms, top 2 by flat:\n") || !strings.Contains(out.String(), "50.00%  gc\n") ||
+		strings.Contains(out.String(), "search") {
+		t.Errorf("unexpected table:\n%s", out)
+	}
+}
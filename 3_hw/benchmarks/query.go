@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"hw3/user"
+	"hw3/useragent"
+
+	"github.com/mailru/easyjson/jlexer"
+)
+
+// DefaultQuery - то, что ищут FastSearch и SlowSearch
+const DefaultQuery = `browsers has "Android" and browsers has "MSIE"`
+
+// Query - скомпилированное выражение вида
+//
+//	browsers has "Android" and (country = "Kenya" or not company has "Inc")
+//
+// Поля: browsers, company, country, email, job, name, phone и разобранные из
+// browsers пакетом useragent browser, browser_version, os, os_version, device.
+// Операторы: has (подстрока), = и !=, для browsers и разобранных полей - "хотя бы
+// один браузер", != - "ни одного браузера".
+// Связки: and, or, not и скобки; and связывает сильнее or.
+type Query struct {
+	src      string
+	root     queryNode
+	browsers []*condition // условия на браузеры, по ним считается Total unique browsers
+}
+
+type queryNode interface {
+	match(r *user.Record) bool
+	// mayMatch - дешёвая проверка по сырой строке: false значит, что строка точно не подходит
+	mayMatch(line []byte) bool
+}
+
+type field int
+
+const (
+	fieldBrowsers field = iota
+	fieldCompany
+	fieldCountry
+	fieldEmail
+	fieldJob
+	fieldName
+	fieldPhone
+
+	// разобранные строки browsers
+	fieldBrowser
+	fieldBrowserVersion
+	fieldOS
+	fieldOSVersion
+	fieldDevice
+)
+
+var fieldNames = map[string]field{
+	"browsers": fieldBrowsers,
+	"company":  fieldCompany,
+	"country":  fieldCountry,
+	"email":    fieldEmail,
+	"job":      fieldJob,
+	"name":     fieldName,
+	"phone":    fieldPhone,
+
+	"browser":         fieldBrowser,
+	"browser_version": fieldBrowserVersion,
+	"os":              fieldOS,
+	"os_version":      fieldOSVersion,
+	"device":          fieldDevice,
+}
+
+func (f field) String() string {
+	for name, value := range fieldNames {
+		if value == f {
+			return name
+		}
+	}
+	return fmt.Sprintf("field(%d)", int(f))
+}
+
+// perBrowser - условие проверяется для каждого браузера записи
+func (f field) perBrowser() bool {
+	return f == fieldBrowsers || f.parsed()
+}
+
+// parsed - поле получается разбором строки браузера
+func (f field) parsed() bool {
+	return f >= fieldBrowser
+}
+
+func (f field) agentValue(a useragent.Agent) string {
+	switch f {
+	case fieldBrowser:
+		return a.Browser
+	case fieldBrowserVersion:
+		return a.BrowserVersion
+	case fieldOS:
+		return a.OS
+	case fieldOSVersion:
+		return a.OSVersion
+	case fieldDevice:
+		return a.Device
+	}
+	return ""
+}
+
+func (f field) value(r *user.Record) string {
+	switch f {
+	case fieldCompany:
+		return r.Company
+	case fieldCountry:
+		return r.Country
+	case fieldEmail:
+		return r.Email
+	case fieldJob:
+		return r.Job
+	case fieldName:
+		return r.Name
+	case fieldPhone:
+		return r.Phone
+	}
+	return ""
+}
+
+type operator int
+
+const (
+	opHas operator = iota
+	opEq
+	opNe
+)
+
+type condition struct {
+	field field
+	op    operator
+	value string
+	raw   []byte // value так, как он выглядит в JSON; nil - если его могли заэкранировать
+
+	agents *useragent.Cache // для разобранных полей, общий на весь запрос
+}
+
+// browserValue - значение поля для одного браузера
+func (c *condition) browserValue(browser string) string {
+	if c.field == fieldBrowsers {
+		return browser
+	}
+	return c.field.agentValue(c.agents.Parse(browser))
+}
+
+// matchBrowser - подходит ли отдельный браузер под has и =
+func (c *condition) matchBrowser(browser string) bool {
+	return c.op != opNe && c.matchString(c.browserValue(browser))
+}
+
+func (c *condition) matchString(s string) bool {
+	switch c.op {
+	case opHas:
+		return strings.Contains(s, c.value)
+	case opEq:
+		return s == c.value
+	}
+	return s != c.value
+}
+
+func (c *condition) match(r *user.Record) bool {
+	if !c.field.perBrowser() {
+		return c.matchString(c.field.value(r))
+	}
+	if c.op == opNe {
+		for _, browser := range r.Browsers {
+			if c.browserValue(browser) == c.value {
+				return false
+			}
+		}
+		return true
+	}
+	for _, browser := range r.Browsers {
+		if c.matchBrowser(browser) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *condition) mayMatch(line []byte) bool {
+	// значения разобранных полей в сырой строке не встречаются
+	if c.op == opNe || c.raw == nil || c.field.parsed() {
+		return true
+	}
+	return bytes.Contains(line, c.raw)
+}
+
+type andNode struct{ left, right queryNode }
+
+func (n andNode) match(r *user.Record) bool { return n.left.match(r) && n.right.match(r) }
+func (n andNode) mayMatch(line []byte) bool {
+	return n.left.mayMatch(line) && n.right.mayMatch(line)
+}
+
+type orNode struct{ left, right queryNode }
+
+func (n orNode) match(r *user.Record) bool { return n.left.match(r) || n.right.match(r) }
+func (n orNode) mayMatch(line []byte) bool {
+	return n.left.mayMatch(line) || n.right.mayMatch(line)
+}
+
+type notNode struct{ node queryNode }
+
+func (n notNode) match(r *user.Record) bool { return !n.node.match(r) }
+func (n notNode) mayMatch(line []byte) bool { return true }
+
+func CompileQuery(src string) (*Query, error) {
+	p := &queryParser{lexer: queryLexer{src: src}}
+	p.next()
+	root := p.parseOr()
+	if p.err == nil && p.tok.kind != tokEOF {
+		p.fail("unexpected %s", p.tok)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Query{src: src, root: root, browsers: p.browsers}, nil
+}
+
+func MustCompileQuery(src string) *Query {
+	q, err := CompileQuery(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+func (q *Query) Match(r *user.Record) bool {
+	return q.root.match(r)
+}
+
+// conditions - все условия запроса
+func (q *Query) conditions() []*condition {
+	var conditions []*condition
+	var walk func(node queryNode)
+	walk = func(node queryNode) {
+		switch n := node.(type) {
+		case andNode:
+			walk(n.left)
+			walk(n.right)
+		case orNode:
+			walk(n.left)
+			walk(n.right)
+		case notNode:
+			walk(n.node)
+		case *condition:
+			conditions = append(conditions, n)
+		}
+	}
+	walk(q.root)
+	return conditions
+}
+
+// countsBrowser - попадает ли браузер в статистику: подходит хотя бы под одно
+// условие на браузеры (кроме !=), независимо от того, подошла ли строка целиком
+func (q *Query) countsBrowser(browser string) bool {
+	for _, c := range q.browsers {
+		if c.matchBrowser(browser) {
+			return true
+		}
+	}
+	return false
+}
+
+// skip - строку можно не разбирать: она не подходит под запрос и в ней нет браузеров для статистики
+func (q *Query) skip(line []byte) bool {
+	if q.root.mayMatch(line) {
+		return false
+	}
+	for _, c := range q.browsers {
+		if c.op != opNe && c.mayMatch(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// QuerySearch - FastSearch с произвольным запросом, формат вывода тот же
+func QuerySearch(out io.Writer, q *Query) error {
+	return QuerySearchMode(out, q, Strict)
+}
+
+// QuerySearchMode - QuerySearch с выбором режима для битых строк
+func QuerySearchMode(out io.Writer, q *Query, mode ParseMode) error {
+	return querySearchFile(out, filePath, q, mode)
+}
+
+func querySearchFile(out io.Writer, path string, q *Query, mode ParseMode) error {
+	file, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result, err := SearchMode(file, q, mode)
+	if err != nil {
+		return err
+	}
+	return TextFormatter{}.Format(out, result)
+}
+
+// queryScan прогоняет строки через запрос и копит браузеры для статистики
+type queryScan struct {
+	q            *Query
+	in           jlexer.Lexer
+	record       user.Record
+	need         [fieldPhone + 1]bool // строковые поля записи, на которые ссылается запрос
+	ownBrowsers  bool                 // браузеры копируются: их хранит useragent.Cache
+	seenBrowsers map[string]struct{}
+	bad          badLines
+}
+
+func newQueryScan(q *Query) *queryScan {
+	s := &queryScan{q: q, seenBrowsers: make(map[string]struct{}, 1000)}
+	// name и email нужны для вывода
+	s.need[fieldName] = true
+	s.need[fieldEmail] = true
+	for _, c := range q.conditions() {
+		if c.field.parsed() {
+			s.ownBrowsers = true
+		} else {
+			s.need[c.field] = true
+		}
+	}
+	return s
+}
+
+// scan читает строки из r, found получает номер строки (от 0) и запись,
+// которая валидна только до возврата из found. Возвращает число прочитанных строк.
+func (s *queryScan) scan(r io.Reader, found func(i int, record *user.Record)) (int, error) {
+	var i int = -1
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		i++
+		line := scanner.Bytes()
+		// пустые строки не разбираются, как и в индексе
+		if len(line) == 0 || s.q.skip(line) {
+			continue
+		}
+
+		if err := s.decode(line); err != nil {
+			if err := s.bad.add(i, err); err != nil {
+				return i + 1, err
+			}
+			continue
+		}
+
+		for _, browser := range s.record.Browsers {
+			if _, ok := s.seenBrowsers[browser]; !ok && s.q.countsBrowser(browser) {
+				s.seenBrowsers[strings.Clone(browser)] = struct{}{}
+			}
+		}
+
+		if s.q.Match(&s.record) {
+			s.record.Name = strings.Clone(s.record.Name)
+			s.record.Email = strings.Clone(s.record.Email)
+			found(i, &s.record)
+		}
+	}
+	return i + 1, scanner.Err()
+}
+
+// decode - разбор line в s.record, как у easyjson.Unmarshal и с теми же ошибками, но
+// заполняются только поля из need, а строки указывают прямо в line. Остальные поля
+// проверяются на тип и выбрасываются.
+func (s *queryScan) decode(line []byte) error {
+	in := &s.in
+	*in = jlexer.Lexer{Data: line}
+	r := &s.record
+	*r = user.Record{Browsers: r.Browsers[:0]}
+	if in.IsNull() {
+		in.Consumed()
+		in.Skip()
+		return in.Error()
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "browsers":
+			in.Delim('[')
+			for !in.IsDelim(']') {
+				if s.ownBrowsers {
+					r.Browsers = append(r.Browsers, in.String())
+				} else {
+					r.Browsers = append(r.Browsers, in.UnsafeString())
+				}
+				in.WantComma()
+			}
+			in.Delim(']')
+		case "company":
+			s.decodeString(fieldCompany, &r.Company)
+		case "country":
+			s.decodeString(fieldCountry, &r.Country)
+		case "email":
+			s.decodeString(fieldEmail, &r.Email)
+		case "job":
+			s.decodeString(fieldJob, &r.Job)
+		case "name":
+			s.decodeString(fieldName, &r.Name)
+		case "phone":
+			s.decodeString(fieldPhone, &r.Phone)
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	in.Consumed()
+	return in.Error()
+}
+
+func (s *queryScan) decodeString(f field, dst *string) {
+	value := s.in.UnsafeString()
+	if s.need[f] {
+		*dst = value
+	}
+}
+
+// --- разбор запроса
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokEq
+	tokNe
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+type queryLexer struct {
+	src string
+	pos int
+}
+
+func (l *queryLexer) next() (token, error) {
+	for l.pos < len(l.src) && (l.src[l.pos] == ' ' || l.src[l.pos] == '\t' || l.src[l.pos] == '\n') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	switch c := l.src[l.pos]; {
+	case c == '(':
+		l.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case c == '=':
+		l.pos++
+		return token{kind: tokEq, text: "=", pos: start}, nil
+	case c == '!' && strings.HasPrefix(l.src[l.pos:], "!="):
+		l.pos += 2
+		return token{kind: tokNe, text: "!=", pos: start}, nil
+	case c == '"':
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != '"' {
+			if l.src[l.pos] == '\\' {
+				l.pos++
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("query: position %d: unterminated string", start)
+		}
+		l.pos++
+		value, err := strconv.Unquote(l.src[start:l.pos])
+		if err != nil {
+			return token{}, fmt.Errorf("query: position %d: bad string %s", start, l.src[start:l.pos])
+		}
+		return token{kind: tokString, text: value, pos: start}, nil
+	case isIdentByte(c):
+		for l.pos < len(l.src) && isIdentByte(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	}
+	return token{}, fmt.Errorf("query: position %d: unexpected character %q", start, l.src[start])
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+type queryParser struct {
+	lexer    queryLexer
+	tok      token
+	err      error
+	browsers []*condition
+	agents   *useragent.Cache
+}
+
+func (p *queryParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lexer.next()
+}
+
+func (p *queryParser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("query: position %d: "+format, append([]interface{}{p.tok.pos}, args...)...)
+	}
+}
+
+func (p *queryParser) keyword(word string) bool {
+	return p.err == nil && p.tok.kind == tokIdent && p.tok.text == word
+}
+
+func (p *queryParser) parseOr() queryNode {
+	node := p.parseAnd()
+	for p.keyword("or") {
+		p.next()
+		node = orNode{node, p.parseAnd()}
+	}
+	return node
+}
+
+func (p *queryParser) parseAnd() queryNode {
+	node := p.parseUnary()
+	for p.keyword("and") {
+		p.next()
+		node = andNode{node, p.parseUnary()}
+	}
+	return node
+}
+
+func (p *queryParser) parseUnary() queryNode {
+	if p.err != nil {
+		return nil
+	}
+	if p.keyword("not") {
+		p.next()
+		return notNode{p.parseUnary()}
+	}
+	if p.tok.kind == tokLParen {
+		p.next()
+		node := p.parseOr()
+		if p.err == nil && p.tok.kind != tokRParen {
+			p.fail("expected ), got %s", p.tok)
+		}
+		p.next()
+		return node
+	}
+	return p.parseCondition()
+}
+
+func (p *queryParser) parseCondition() queryNode {
+	if p.tok.kind != tokIdent {
+		p.fail("expected field, got %s", p.tok)
+		return nil
+	}
+	f, ok := fieldNames[p.tok.text]
+	if !ok {
+		p.fail("unknown field %s", p.tok)
+		return nil
+	}
+	p.next()
+
+	var op operator
+	switch {
+	case p.keyword("has"):
+		op = opHas
+	case p.err == nil && p.tok.kind == tokEq:
+		op = opEq
+	case p.err == nil && p.tok.kind == tokNe:
+		op = opNe
+	default:
+		p.fail("expected has, = or !=, got %s", p.tok)
+		return nil
+	}
+	p.next()
+
+	if p.err == nil && p.tok.kind != tokString {
+		p.fail("expected string, got %s", p.tok)
+	}
+	if p.err != nil {
+		return nil
+	}
+	c := &condition{field: f, op: op, value: p.tok.text, raw: jsonLiteral(p.tok.text)}
+	p.next()
+
+	if f.perBrowser() {
+		p.browsers = append(p.browsers, c)
+	}
+	if f.parsed() {
+		if p.agents == nil {
+			p.agents = useragent.NewCache()
+		}
+		c.agents = p.agents
+	}
+	return c
+}
+
+// jsonLiteral возвращает строку в том виде, в каком она записана в JSON, если
+// её там не могли заэкранировать; иначе nil, и по сырой строке её не ищем
+func jsonLiteral(s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x80 || c == '"' || c == '\\' || c == '/' || c == '<' || c == '>' || c == '&' {
+			return nil
+		}
+	}
+	return []byte(s)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"hw3/user"
+	"hw3/useragent"
+)
+
+func TestQuerySearchDefault(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	queryOut := new(bytes.Buffer)
+	if err := QuerySearch(queryOut, MustCompileQuery(DefaultQuery)); err != nil {
+		t.Fatal(err)
+	}
+
+	if queryOut.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", queryOut, fastOut)
+	}
+}
+
+// referenceSearch - тот же поиск без prefilter и easyjson, с предикатом на Go
+func referenceSearch(t *testing.T, match func(r *user.Record) bool, counts func(browser string) bool) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	found := ""
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for i := 0; scanner.Scan(); i++ {
+		var r user.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range r.Browsers {
+			if counts(b) {
+				seen[b] = true
+			}
+		}
+		if match(&r) {
+			found += fmt.Sprintf("[%d] %s <%s>\n", i, r.Name, strings.Replace(r.Email, "@", " [at] ", 1))
+		}
+	}
+	return "found users:\n" + found + fmt.Sprintf("\nTotal unique browsers %d\n", len(seen))
+}
+
+func anyBrowser(r *user.Record, f func(string) bool) bool {
+	for _, b := range r.Browsers {
+		if f(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestQuerySearch(t *testing.T) {
+	has := func(s string) func(string) bool {
+		return func(b string) bool { return strings.Contains(b, s) }
+	}
+	cases := []struct {
+		query  string
+		match  func(r *user.Record) bool
+		counts func(browser string) bool
+	}{
+		{
+			query: `browsers has "Android" and country = "Kenya"`,
+			match: func(r *user.Record) bool {
+				return anyBrowser(r, has("Android")) && r.Country == "Kenya"
+			},
+			counts: has("Android"),
+		},
+		{
+			query: `(browsers has "Opera" or browsers has "Safari") and not company has "Inc" and job != "Developer"`,
+			match: func(r *user.Record) bool {
+				return (anyBrowser(r, has("Opera")) || anyBrowser(r, has("Safari"))) && !strings.Contains(r.Company, "Inc") && r.Job != "Developer"
+			},
+			counts: func(b string) bool { return strings.Contains(b, "Opera") || strings.Contains(b, "Safari") },
+		},
+		{
+			query: `email has ".edu" or name = "Sharon Crawford"`,
+			match: func(r *user.Record) bool {
+				return strings.Contains(r.Email, ".edu") || r.Name == "Sharon Crawford"
+			},
+			counts: func(string) bool { return false },
+		},
+		{
+			query: `browser = "IE" and os = "Windows" and device != "mobile"`,
+			match: func(r *user.Record) bool {
+				return anyBrowser(r, func(b string) bool { return useragent.Parse(b).Browser == "IE" }) &&
+					anyBrowser(r, func(b string) bool { return useragent.Parse(b).OS == "Windows" }) &&
+					!anyBrowser(r, func(b string) bool { return useragent.Parse(b).Device == "mobile" })
+			},
+			counts: func(b string) bool {
+				a := useragent.Parse(b)
+				return a.Browser == "IE" || a.OS == "Windows"
+			},
+		},
+		{
+			query: `browser_version has "11." or os_version = "8.1"`,
+			match: func(r *user.Record) bool {
+				return anyBrowser(r, func(b string) bool {
+					a := useragent.Parse(b)
+					return strings.Contains(a.BrowserVersion, "11.") || a.OSVersion == "8.1"
+				})
+			},
+			counts: func(b string) bool {
+				a := useragent.Parse(b)
+				return strings.Contains(a.BrowserVersion, "11.") || a.OSVersion == "8.1"
+			},
+		},
+	}
+
+	for _, c := range cases {
+		out := new(bytes.Buffer)
+		if err := QuerySearch(out, MustCompileQuery(c.query)); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		if expected := referenceSearch(t, c.match, c.counts); out.String() != expected {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", c.query, out, expected)
+		}
+	}
+}
+
+func TestQueryAgentFields(t *testing.T) {
+	// IE 11 не пишет MSIE, подстрока его не находит, а разобранное поле - находит
+	ie11 := "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko"
+	r := &user.Record{Browsers: []string{ie11}}
+	for src, expected := range map[string]bool{
+		`browsers has "MSIE"`:                         false,
+		`browser = "IE" and browser_version = "11.0"`: true,
+		`os = "Windows" and os_version = "7"`:         true,
+		`device = "desktop"`:                          true,
+		`device != "desktop"`:                         false,
+		`browser = "Chrome"`:                          false,
+	} {
+		if got := MustCompileQuery(src).Match(r); got != expected {
+			t.Errorf("%s: got %v, expected %v", src, got, expected)
+		}
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`browsers`,
+		`browsers has`,
+		`browsers has Android`,
+		`age = "1"`,
+		`name ~ "x"`,
+		`name = "x" and`,
+		`(name = "x"`,
+		`name = "x")`,
+		`name = "x`,
+		`name = "x" or or name = "y"`,
+	} {
+		if _, err := CompileQuery(src); err == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+}
+
+func TestQueryMatchNoAllocs(t *testing.T) {
+	q := MustCompileQuery(`browsers has "Android" and browsers != "MSIE" and (country = "Kenya" or not email has "@")`)
+	r := &user.Record{Browsers: []string{"Android 4.0", "Opera"}, Country: "Kenya", Email: "a@b.c"}
+	if !q.Match(r) {
+		t.Fatal("expected match")
+	}
+	line := []byte(`{"browsers":["Android 4.0"],"country":"Kenya"}`)
+	allocs := testing.AllocsPerRun(100, func() {
+		q.Match(r)
+		q.skip(line)
+		q.countsBrowser(r.Browsers[0])
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+
+	// разбор строк в scan: браузеры уже в статистике, строки не подходят - аллокаций
+	// столько же, сколько на пустом входе (bufio.Scanner и его буфер)
+	rows := []string{
+		`{"browsers":["Android 4.0","MSIE 8.0"],"company":"Inc","country":"Chad","email":"a@b.c","job":"x","name":"A","phone":"1"}`,
+		`{"browsers":["Android 4.0"],"country":"Peru","email":"d@e.f","name":"B"}`,
+	}
+	var input []byte
+	for i := 0; i < 100; i++ {
+		input = append(input, rows[i%len(rows)]+"\n"...)
+	}
+	search := newQueryScan(q)
+	scanAllocs := func(input []byte) float64 {
+		return testing.AllocsPerRun(20, func() {
+			lines, err := search.scan(bytes.NewReader(input), func(i int, record *user.Record) {
+				t.Errorf("unexpected match at line %d", i)
+			})
+			if err != nil || lines != bytes.Count(input, []byte("\n")) {
+				t.Fatalf("scan: %d lines, %v", lines, err)
+			}
+		})
+	}
+	scanAllocs(input)
+	if len(search.seenBrowsers) != 1 || len(search.bad.errs) != 0 {
+		t.Fatalf("unexpected scan state: %v, %v", search.seenBrowsers, search.bad.errs)
+	}
+	if empty, full := scanAllocs(nil), scanAllocs(input); full != empty {
+		t.Errorf("scan of %d lines made %v allocations, empty input %v", 100, full, empty)
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	q := MustCompileQuery(DefaultQuery)
+	for i := 0; i < b.N; i++ {
+		QuerySearch(ioutil.Discard, q)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"hw3/user"
+	"hw3/useragent"
+
+	"github.com/mailru/easyjson"
+)
+
+// DefaultReportTop - сколько строк оставлять в топах и перекрёстных таблицах
+const DefaultReportTop = 10
+
+// Report - сводная статистика по users.txt за один проход.
+// Страны и компании считаются по пользователям, браузеры, ОС и устройства - по
+// строкам browsers (у пользователя их несколько).
+type Report struct {
+	Users          int `json:"users"`
+	Browsers       int `json:"browsers"`
+	UniqueBrowsers int `json:"unique_browsers"`
+
+	Countries       Counts `json:"countries"`
+	Companies       Counts `json:"companies"`
+	BrowserFamilies Counts `json:"browser_families"`
+	OS              Counts `json:"os"`
+	Devices         Counts `json:"devices"`
+
+	BrowserByCountry CrossTab `json:"browser_by_country"`
+	OSByBrowser      CrossTab `json:"os_by_browser"`
+}
+
+type Count struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// Counts - топ значений по убыванию, при равенстве - по алфавиту
+type Counts struct {
+	Distinct int     `json:"distinct"`
+	Top      []Count `json:"top"`
+}
+
+// CrossTab - Counts[i][j] для Rows[i] и Columns[j]; строки и столбцы - топы своих измерений
+type CrossTab struct {
+	Rows    []string `json:"rows"`
+	Columns []string `json:"columns"`
+	Counts  [][]int  `json:"counts"`
+}
+
+type pair struct{ row, column string }
+
+type reportBuilder struct {
+	agents       *useragent.Cache
+	record       user.Record
+	report       Report
+	countries    map[string]int
+	companies    map[string]int
+	families     map[string]int
+	oses         map[string]int
+	devices      map[string]int
+	byCountry    map[pair]int
+	osByBrowser  map[pair]int
+	seenBrowsers map[string]struct{}
+}
+
+func newReportBuilder() *reportBuilder {
+	return &reportBuilder{
+		agents:       useragent.NewCache(),
+		countries:    make(map[string]int),
+		companies:    make(map[string]int),
+		families:     make(map[string]int),
+		oses:         make(map[string]int),
+		devices:      make(map[string]int),
+		byCountry:    make(map[pair]int),
+		osByBrowser:  make(map[pair]int),
+		seenBrowsers: make(map[string]struct{}, 1000),
+	}
+}
+
+func (b *reportBuilder) add(r *user.Record) {
+	b.report.Users++
+	b.report.Browsers += len(r.Browsers)
+	b.countries[r.Country]++
+	b.companies[r.Company]++
+	for _, browser := range r.Browsers {
+		b.seenBrowsers[browser] = struct{}{}
+		agent := b.agents.Parse(browser)
+		b.families[agent.Browser]++
+		b.oses[agent.OS]++
+		b.devices[agent.Device]++
+		b.byCountry[pair{r.Country, agent.Browser}]++
+		b.osByBrowser[pair{agent.Browser, agent.OS}]++
+	}
+}
+
+func (b *reportBuilder) build(top int) *Report {
+	rep := b.report
+	rep.UniqueBrowsers = len(b.seenBrowsers)
+	rep.Countries = topCounts(b.countries, top)
+	rep.Companies = topCounts(b.companies, top)
+	rep.BrowserFamilies = topCounts(b.families, top)
+	rep.OS = topCounts(b.oses, top)
+	rep.Devices = topCounts(b.devices, top)
+	rep.BrowserByCountry = crossTab(b.byCountry, rep.Countries, rep.BrowserFamilies)
+	rep.OSByBrowser = crossTab(b.osByBrowser, rep.BrowserFamilies, rep.OS)
+	return &rep
+}
+
+// topCounts сортирует значения; top <= 0 - без ограничения
+func topCounts(counts map[string]int, top int) Counts {
+	list := make([]Count, 0, len(counts))
+	for key, n := range counts {
+		list = append(list, Count{key, n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Key < list[j].Key
+	})
+	if top > 0 && len(list) > top {
+		list = list[:top]
+	}
+	return Counts{Distinct: len(counts), Top: list}
+}
+
+func crossTab(counts map[pair]int, rows, columns Counts) CrossTab {
+	tab := CrossTab{Rows: keys(rows), Columns: keys(columns)}
+	tab.Counts = make([][]int, len(tab.Rows))
+	for i, row := range tab.Rows {
+		tab.Counts[i] = make([]int, len(tab.Columns))
+		for j, column := range tab.Columns {
+			tab.Counts[i][j] = counts[pair{row, column}]
+		}
+	}
+	return tab
+}
+
+func keys(c Counts) []string {
+	list := make([]string, len(c.Top))
+	for i, count := range c.Top {
+		list[i] = count.Key
+	}
+	return list
+}
+
+// BuildReport считает Report по строкам из r за один проход
+func BuildReport(r io.Reader, top int) (*Report, error) {
+	b := newReportBuilder()
+	scanner := bufio.NewScanner(r)
+	for i := 0; scanner.Scan(); i++ {
+		b.record = user.Record{Browsers: b.record.Browsers[:0]}
+		if err := easyjson.Unmarshal(scanner.Bytes(), &b.record); err != nil {
+			return nil, &LineError{Line: i, Err: err}
+		}
+		b.add(&b.record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b.build(top), nil
+}
+
+// ReportSearch - отчёт по users.txt в формате text или json
+func ReportSearch(out io.Writer, format string, top int) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown report format %q, expected text or json", format)
+	}
+
+	file, err := openInput(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rep, err := BuildReport(file, top)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		return json.NewEncoder(out).Encode(rep)
+	}
+	return rep.WriteText(out)
+}
+
+// WriteText выводит отчёт таблицами, выровненными по колонкам
+func (rep *Report) WriteText(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "users %d, browsers %d, unique browsers %d\n", rep.Users, rep.Browsers, rep.UniqueBrowsers)
+
+	for _, section := range []struct {
+		title  string
+		counts Counts
+	}{
+		{"country", rep.Countries},
+		{"company", rep.Companies},
+		{"browser", rep.BrowserFamilies},
+		{"os", rep.OS},
+		{"device", rep.Devices},
+	} {
+		writer.WriteByte('\n')
+		table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(table, "%s (%d)\n", section.title, section.counts.Distinct)
+		for _, c := range section.counts.Top {
+			fmt.Fprintf(table, "%s\t%d\n", c.Key, c.Count)
+		}
+		table.Flush()
+	}
+
+	writeCrossTab(writer, "browser by country", rep.BrowserByCountry)
+	writeCrossTab(writer, "os by browser", rep.OSByBrowser)
+	return writer.Flush()
+}
+
+func writeCrossTab(writer *bufio.Writer, title string, tab CrossTab) {
+	writer.WriteByte('\n')
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	table.Write([]byte(title))
+	for _, column := range tab.Columns {
+		table.Write([]byte("\t" + column))
+	}
+	table.Write([]byte("\n"))
+	for i, row := range tab.Rows {
+		table.Write([]byte(row))
+		for _, n := range tab.Counts[i] {
+			table.Write([]byte("\t" + strconv.Itoa(n)))
+		}
+		table.Write([]byte("\n"))
+	}
+	table.Flush()
+}
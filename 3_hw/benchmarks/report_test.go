@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"hw3/user"
+	"hw3/useragent"
+)
+
+const reportInput = `{"browsers":["Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko","Opera/9.80 (X11; Linux x86_64) Presto/2.12.388 Version/12.16"],"company":"Acme","country":"Malta"}
+{"browsers":["Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko"],"company":"Acme","country":"Kenya"}
+{"browsers":[],"company":"Initech","country":"Malta"}`
+
+func TestBuildReport(t *testing.T) {
+	rep, err := BuildReport(strings.NewReader(reportInput), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "users 3, browsers 3, unique browsers 2\n" +
+		"\ncountry (2)\nMalta  2\nKenya  1\n" +
+		"\ncompany (2)\nAcme     2\nInitech  1\n" +
+		"\nbrowser (2)\nIE     2\nOpera  1\n" +
+		"\nos (2)\nWindows  2\nLinux    1\n" +
+		"\ndevice (1)\ndesktop  3\n" +
+		"\nbrowser by country  IE  Opera\nMalta               1   1\nKenya               1   0\n" +
+		"\nos by browser  Windows  Linux\nIE             2        0\nOpera          0        1\n"
+	out := new(bytes.Buffer)
+	if err := rep.WriteText(out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", out, expected)
+	}
+
+	var decoded Report
+	data, _ := json.Marshal(rep)
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(&decoded, rep) {
+		t.Errorf("json round trip: %v\n%s", err, data)
+	}
+
+	top, _ := BuildReport(strings.NewReader(reportInput), 1)
+	if top.Countries.Distinct != 2 || len(top.Countries.Top) != 1 || len(top.BrowserByCountry.Counts) != 1 {
+		t.Errorf("unexpected top 1 report %+v", top)
+	}
+}
+
+// TestReportFile сверяет отчёт по users.txt с подсчётом через encoding/json
+func TestReportFile(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	countries := map[string]int{}
+	families := map[string]int{}
+	byCountry := map[pair]int{}
+	users, browsers := 0, 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r user.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		users++
+		browsers += len(r.Browsers)
+		countries[r.Country]++
+		for _, b := range r.Browsers {
+			family := useragent.Parse(b).Browser
+			families[family]++
+			byCountry[pair{r.Country, family}]++
+		}
+	}
+
+	file.Seek(0, 0)
+	rep, err := BuildReport(file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Users != users || rep.Browsers != browsers || rep.Countries.Distinct != len(countries) || rep.BrowserFamilies.Distinct != len(families) {
+		t.Fatalf("unexpected totals %d users, %d browsers, %d countries, %d families",
+			rep.Users, rep.Browsers, rep.Countries.Distinct, rep.BrowserFamilies.Distinct)
+	}
+	for _, c := range rep.Countries.Top {
+		if countries[c.Key] != c.Count {
+			t.Errorf("country %q: got %d, expected %d", c.Key, c.Count, countries[c.Key])
+		}
+	}
+	for i, row := range rep.BrowserByCountry.Rows {
+		for j, column := range rep.BrowserByCountry.Columns {
+			if n := rep.BrowserByCountry.Counts[i][j]; n != byCountry[pair{row, column}] {
+				t.Errorf("%s/%s: got %d, expected %d", row, column, n, byCountry[pair{row, column}])
+			}
+		}
+	}
+
+	file.Seek(0, 0)
+	all, _ := Search(file, MustCompileQuery(`browsers has ""`))
+	if rep.UniqueBrowsers != all.UniqueBrowsers {
+		t.Errorf("unique browsers: got %d, expected %d", rep.UniqueBrowsers, all.UniqueBrowsers)
+	}
+}
+
+func TestReportErrors(t *testing.T) {
+	_, err := BuildReport(strings.NewReader(reportInput+"\n{"), 0)
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 {
+		t.Errorf("expected error on line 3, got %v", err)
+	}
+	if err := ReportSearch(ioutil.Discard, "xml", 0); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func BenchmarkReport(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ReportSearch(ioutil.Discard, "text", DefaultReportTop)
+	}
+}
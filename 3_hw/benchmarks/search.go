@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"hw3/user"
+)
+
+// FoundUser - пользователь, подошедший под запрос; Index - номер строки во входе, с 0
+type FoundUser struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type SearchResult struct {
+	Users          []FoundUser
+	UniqueBrowsers int          // сколько разных браузеров подошло под условия на browsers
+	Lines          int          // сколько строк прочитано
+	Skipped        int          // сколько битых строк пропущено в режиме Tolerant
+	BadLines       []*LineError // первые maxBadLines из них, по порядку
+}
+
+// LineError - строку входа не удалось разобрать
+type LineError struct {
+	Line int // с 0, как Index
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ParseMode - что делать со строкой, которую не удалось разобрать. Режим
+// выбирают SearchMode, QuerySearchMode, ParallelSearchMode, ScanSearchMode и
+// TolerantSearch; остальные строгие: FastSearch и SlowSearch паникуют (сигнатура
+// из задания), IndexSearch, ReportSearch, LoadUserStore и прочие возвращают *LineError.
+type ParseMode int
+
+const (
+	Strict   ParseMode = iota // остановиться и вернуть *LineError
+	Tolerant                  // пропустить строку и учесть её в Skipped и BadLines
+)
+
+// maxBadLines - сколько пропущенных строк запоминать с причиной: в битом дампе их
+// может быть миллион, а для отчёта хватит первых
+const maxBadLines = 100
+
+// badLines - учёт битых строк, общий для Search и fastLines
+type badLines struct {
+	mode    ParseMode
+	skipped int
+	errs    []*LineError
+}
+
+// add - строку i не удалось разобрать. В режиме Strict возвращает ошибку,
+// в Tolerant запоминает её и возвращает nil.
+func (b *badLines) add(i int, err error) error {
+	lineErr := &LineError{Line: i, Err: err}
+	if b.mode == Strict {
+		return lineErr
+	}
+	b.skipped++
+	if len(b.errs) < maxBadLines {
+		b.errs = append(b.errs, lineErr)
+	}
+	return nil
+}
+
+// Search ищет по строкам из r (файл, stdin, тело запроса, gzip.Reader...).
+// nil q - DefaultQuery, то есть то же, что FastSearch.
+func Search(r io.Reader, q *Query) (*SearchResult, error) {
+	return SearchMode(r, q, Strict)
+}
+
+// SearchMode - Search, который в режиме Tolerant пропускает битые строки
+// (обрезанные, с мусором) вместо того, чтобы остановиться на первой. Битыми
+// считаются только разобранные строки: ту, что запрос отсеял без разбора
+// (Query.skip), никто не проверяет.
+func SearchMode(r io.Reader, q *Query, mode ParseMode) (*SearchResult, error) {
+	if q == nil {
+		q = defaultQuery
+	}
+
+	result := &SearchResult{}
+	search := newQueryScan(q)
+	search.bad.mode = mode
+	lines, err := search.scan(r, func(i int, record *user.Record) {
+		result.Users = append(result.Users, FoundUser{Index: i, Name: record.Name, Email: record.Email})
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Lines = lines
+	result.UniqueBrowsers = len(search.seenBrowsers)
+	result.Skipped = search.bad.skipped
+	result.BadLines = search.bad.errs
+	return result, nil
+}
+
+var defaultQuery = MustCompileQuery(DefaultQuery)
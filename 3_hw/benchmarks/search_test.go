@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const searchInput = `{"browsers":["Android 4","MSIE 9"],"name":"Ann, \"A\"","email":"ann@x.org"}
+{"browsers":["Opera"],"name":"Bob","email":"bob@x.org"}
+{"browsers":["MSIE 8","Android 2"],"name":"Cid","email":"cid@x.org"}`
+
+func TestSearchReader(t *testing.T) {
+	result, err := Search(strings.NewReader(searchInput), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Lines != 3 || result.UniqueBrowsers != 4 || len(result.Users) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if u := result.Users[1]; u.Index != 2 || u.Name != "Cid" || u.Email != "cid@x.org" {
+		t.Errorf("unexpected user %+v", u)
+	}
+
+	cases := map[string]string{
+		"text": "found users:\n[0] Ann, \"A\" <ann [at] x.org>\n[2] Cid <cid [at] x.org>\n\nTotal unique browsers 4\n",
+		"jsonl": `{"index":0,"name":"Ann, \"A\"","email":"ann [at] x.org"}` + "\n" +
+			`{"index":2,"name":"Cid","email":"cid [at] x.org"}` + "\n" +
+			`{"unique_browsers":4}` + "\n",
+		"csv": "index,name,email\n0,\"Ann, \"\"A\"\"\",ann [at] x.org\n2,Cid,cid [at] x.org\n",
+	}
+	for name, expected := range cases {
+		f, err := NewFormatter(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		if err := f.Format(out, result); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != expected {
+			t.Errorf("%s: got\n%s\nexpected\n%s", name, out, expected)
+		}
+	}
+
+	if _, err := NewFormatter("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestSearchFileText(t *testing.T) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	result, err := Search(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := (TextFormatter{}).Format(out, result); err != nil {
+		t.Fatal(err)
+	}
+
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+}
+
+func TestSearchBadLine(t *testing.T) {
+	input := searchInput + "\n" + `{"browsers":["MSIE"],"name":` + "\n"
+	_, err := Search(strings.NewReader(input), nil)
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 {
+		t.Errorf("expected error on line 3, got %v", err)
+	}
+}
+
+// badInput - searchInput с обрезанной строкой и мусором между нормальными
+const badInput = `{"browsers":["Android 4","MSIE 9"],"name":"Ann, \"A\"","email":"ann@x.org"}
+{"browsers":["MSIE 7","Android` + `
+{"browsers":["Opera"],"name":"Bob","email":"bob@x.org"}
+MSIE Android
+{"browsers":["MSIE 8","Android 2"],"name":"Cid","email":"cid@x.org"}`
+
+func TestSearchTolerant(t *testing.T) {
+	if _, err := Search(strings.NewReader(badInput), nil); err == nil {
+		t.Fatal("expected error in strict mode")
+	}
+
+	result, err := SearchMode(strings.NewReader(badInput), nil, Tolerant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Lines != 5 || result.Skipped != 2 || len(result.BadLines) != 2 ||
+		result.BadLines[0].Line != 1 || result.BadLines[1].Line != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(result.Users) != 2 || result.Users[0].Index != 0 || result.Users[1].Index != 4 || result.UniqueBrowsers != 4 {
+		t.Errorf("unexpected users %+v, %d unique browsers", result.Users, result.UniqueBrowsers)
+	}
+
+	out := new(bytes.Buffer)
+	TextFormatter{}.Format(out, result)
+	expected := "found users:\n[0] Ann, \"A\" <ann [at] x.org>\n[4] Cid <cid [at] x.org>\n\nTotal unique browsers 4\n\n" +
+		"Skipped 2 bad lines:\n" + result.BadLines[0].Error() + "\n" + result.BadLines[1].Error() + "\n"
+	if out.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", out, expected)
+	}
+
+	out.Reset()
+	JSONLinesFormatter{}.Format(out, result)
+	if !strings.HasSuffix(out.String(), `{"unique_browsers":4,"skipped":2,"bad_lines":[{"line":1,"error":`+
+		strconv.Quote(result.BadLines[0].Err.Error())+`},{"line":3,"error":`+strconv.Quote(result.BadLines[1].Err.Error())+"}]}\n") {
+		t.Errorf("unexpected jsonl summary:\n%s", out)
+	}
+}
+
+func TestSearchTolerantLimit(t *testing.T) {
+	input := strings.Repeat("{\"browsers\":[\"MSIE\n", maxBadLines+5) + `{"browsers":["MSIE"],"name":"x"}`
+	result, err := SearchMode(strings.NewReader(input), nil, Tolerant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped != maxBadLines+5 || len(result.BadLines) != maxBadLines || result.Lines != maxBadLines+6 {
+		t.Fatalf("skipped %d, kept %d, lines %d", result.Skipped, len(result.BadLines), result.Lines)
+	}
+	out := new(bytes.Buffer)
+	TextFormatter{}.Format(out, result)
+	if !strings.HasSuffix(out.String(), "\n... and 5 more\n") {
+		t.Errorf("unexpected summary ending:\n%s", out.String()[out.Len()-100:])
+	}
+}
+
+func writeInput(t *testing.T, input string) string {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestTolerantModes - QuerySearchMode и ParallelSearchMode пропускают те же строки, что и SearchMode
+func TestTolerantModes(t *testing.T) {
+	tooBad := strings.Repeat("{\"browsers\":[\"MSIE\n", maxBadLines+5) + `{"browsers":["MSIE"],"name":"x"}`
+	for _, input := range []string{badInput, tooBad} {
+		path := writeInput(t, input)
+		result, err := SearchMode(strings.NewReader(input), nil, Tolerant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := new(bytes.Buffer)
+		TextFormatter{}.Format(expected, result)
+
+		searches := map[string]func(out *bytes.Buffer, mode ParseMode) error{
+			"query": func(out *bytes.Buffer, mode ParseMode) error { return querySearchFile(out, path, nil, mode) },
+		}
+		for _, workers := range []int{1, 2, 4} {
+			searches["parallel "+strconv.Itoa(workers)] = func(out *bytes.Buffer, mode ParseMode) error {
+				return parallelSearchFile(out, path, defaultQuery, workers, mode)
+			}
+		}
+		for name, search := range searches {
+			out := new(bytes.Buffer)
+			if err := search(out, Tolerant); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if out.String() != expected.String() {
+				t.Errorf("%s: got\n%v\nexpected\n%v", name, out, expected)
+			}
+			var lineErr *LineError
+			if err := search(new(bytes.Buffer), Strict); !errors.As(err, &lineErr) || lineErr.Line != result.BadLines[0].Line {
+				t.Errorf("%s: expected error on line %d in strict mode, got %v", name, result.BadLines[0].Line, err)
+			}
+		}
+	}
+}
+
+// TestScanSearchMode - у userScanner свои тексты ошибок, поэтому сравниваются номера строк
+func TestScanSearchMode(t *testing.T) {
+	path := writeInput(t, badInput)
+	var lineErr *LineError
+	if err := scanSearchFile(new(bytes.Buffer), path, Strict, DefaultMasking); !errors.As(err, &lineErr) || lineErr.Line != 1 {
+		t.Errorf("expected error on line 1 in strict mode, got %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := scanSearchFile(out, path, Tolerant, DefaultMasking); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	expected := []string{"found users:", `[0] Ann, "A" <ann [at] x.org>`, "[4] Cid <cid [at] x.org>", "",
+		"Total unique browsers 4", "", "Skipped 2 bad lines:"}
+	if len(lines) != len(expected)+3 || strings.Join(lines[:len(expected)], "\n") != strings.Join(expected, "\n") ||
+		!strings.HasPrefix(lines[len(expected)], "line 1: ") || !strings.HasPrefix(lines[len(expected)+1], "line 3: ") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+// TestStrictSearches - пути без режима Tolerant на битой строке падают с её номером, а не молча
+func TestStrictSearches(t *testing.T) {
+	path := writeInput(t, badInput)
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(r.(string), "unmarshal error") {
+				t.Errorf("FastSearch: expected unmarshal panic, got %v", r)
+			}
+		}()
+		fastSearchFile(new(bytes.Buffer), path, DefaultMasking)
+	}()
+
+	for name, search := range map[string]func() error{
+		"index":  func() error { _, err := BuildIndex(path); return err },
+		"report": func() error { _, err := BuildReport(strings.NewReader(badInput), 10); return err },
+		"store":  func() error { _, err := LoadUserStore(strings.NewReader(badInput)); return err },
+	} {
+		var lineErr *LineError
+		if err := search(); !errors.As(err, &lineErr) || lineErr.Line != 1 {
+			t.Errorf("%s: expected error on line 1, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hw3/user"
+	"hw3/useragent"
+
+	"github.com/mailru/easyjson"
+)
+
+// UserStore - users.txt в памяти для SearchServer. От записи остаются только
+// name, email и browsers: каждая строка браузера хранится один раз, у
+// пользователя - номера браузеров, а name и email всех пользователей лежат
+// подряд в одной строке.
+type UserStore struct {
+	browsers   []string // уникальные строки браузеров
+	browserIDs []uint32 // номера браузеров всех пользователей подряд
+	text       string   // name и email всех пользователей подряд
+
+	// пользователь i: name - text[textStart[i]:nameEnd[i]], email - text[nameEnd[i]:textStart[i+1]],
+	// браузеры - browserIDs[browserStart[i]:browserStart[i+1]]
+	textStart    []uint32
+	nameEnd      []uint32
+	browserStart []uint32
+
+	agents *useragent.Cache // разобранные браузеры, общие для всех запросов
+}
+
+var errStoreTooBig = errors.New("store: names and emails do not fit in 4GB")
+
+// LoadUserStore читает строки users.txt из r; пользователь i - строка i
+func LoadUserStore(r io.Reader) (*UserStore, error) {
+	s := &UserStore{agents: useragent.NewCache()}
+	ids := make(map[string]uint32, 1000)
+	text := &strings.Builder{}
+
+	var u user.User
+	scanner := bufio.NewScanner(r)
+	for i := 0; scanner.Scan(); i++ {
+		u = user.User{Browsers: u.Browsers[:0]}
+		if err := easyjson.Unmarshal(scanner.Bytes(), &u); err != nil {
+			return nil, &LineError{Line: i, Err: err}
+		}
+		if text.Len()+len(u.Name)+len(u.Email) > math.MaxUint32 {
+			return nil, errStoreTooBig
+		}
+
+		s.textStart = append(s.textStart, uint32(text.Len()))
+		text.WriteString(u.Name)
+		s.nameEnd = append(s.nameEnd, uint32(text.Len()))
+		text.WriteString(u.Email)
+
+		s.browserStart = append(s.browserStart, uint32(len(s.browserIDs)))
+		for _, browser := range u.Browsers {
+			id, ok := ids[browser]
+			if !ok {
+				id = uint32(len(s.browsers))
+				ids[browser] = id
+				s.browsers = append(s.browsers, browser)
+			}
+			s.browserIDs = append(s.browserIDs, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	s.textStart = append(s.textStart, uint32(text.Len()))
+	s.browserStart = append(s.browserStart, uint32(len(s.browserIDs)))
+	s.text = text.String()
+	return s, nil
+}
+
+// LoadUserStoreFile - LoadUserStore из файла, сжатого или нет
+func LoadUserStoreFile(path string) (*UserStore, error) {
+	file, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadUserStore(file)
+}
+
+// Len - число пользователей
+func (s *UserStore) Len() int {
+	return len(s.nameEnd)
+}
+
+// size - сколько байт занимают данные хранилища, без заголовков слайсов и строк
+func (s *UserStore) size() int {
+	n := len(s.text) + 4*(len(s.browserIDs)+len(s.textStart)+len(s.nameEnd)+len(s.browserStart))
+	for _, browser := range s.browsers {
+		n += len(browser)
+	}
+	return n
+}
+
+func (s *UserStore) name(i int) string {
+	return s.text[s.textStart[i]:s.nameEnd[i]]
+}
+
+func (s *UserStore) email(i int) string {
+	return s.text[s.nameEnd[i]:s.textStart[i+1]]
+}
+
+// storeFields - поля, по которым можно искать в UserStore
+var storeFields = map[field]bool{
+	fieldBrowsers: true, fieldName: true, fieldEmail: true,
+	fieldBrowser: true, fieldBrowserVersion: true, fieldOS: true, fieldOSVersion: true, fieldDevice: true,
+}
+
+// SearchPage - страница результата поиска по UserStore
+type SearchPage struct {
+	Query          string      `json:"query"`
+	Total          int         `json:"total"` // сколько всего пользователей подошло
+	Offset         int         `json:"offset"`
+	Limit          int         `json:"limit"`
+	UniqueBrowsers int         `json:"unique_browsers"`
+	Users          []FoundUser `json:"users"`
+}
+
+// Search - пользователи с offset по offset+limit из подошедших под q и
+// Total unique browsers, как у Search; nil q - DefaultQuery
+func (s *UserStore) Search(q *Query, offset, limit int) (*SearchPage, error) {
+	if q == nil {
+		q = defaultQuery
+	}
+	for _, c := range q.conditions() {
+		if !storeFields[c.field] {
+			return nil, fmt.Errorf("field %s is not kept in memory, only browsers, name, email and fields parsed from browsers", c.field)
+		}
+	}
+
+	page := &SearchPage{Query: q.String(), Offset: offset, Limit: limit, Users: []FoundUser{}}
+	sq := &storeQuery{store: s, browsers: make(map[*condition][]bool)}
+	for i := 0; i < s.Len(); i++ {
+		if !sq.match(q.root, i) {
+			continue
+		}
+		if page.Total >= offset && len(page.Users) < limit {
+			page.Users = append(page.Users, FoundUser{Index: i, Name: s.name(i), Email: s.email(i)})
+		}
+		page.Total++
+	}
+	// все браузеры файла есть в словаре, так что статистика по нему та же, что
+	// по строкам; проверка - как в Query.countsBrowser
+	for _, browser := range s.browsers {
+		for _, c := range q.browsers {
+			if c.op != opNe && c.matchString(sq.browserValue(c, browser)) {
+				page.UniqueBrowsers++
+				break
+			}
+		}
+	}
+	return page, nil
+}
+
+// storeQuery проверяет запрос по пользователю хранилища. Условие на браузеры
+// считается один раз для каждого браузера словаря, а не для каждого браузера
+// каждого пользователя, дальше - только поиск по номерам.
+type storeQuery struct {
+	store    *UserStore
+	browsers map[*condition][]bool // по номеру браузера: matchBrowser, для != - равенство
+}
+
+func (sq *storeQuery) match(node queryNode, i int) bool {
+	switch n := node.(type) {
+	case andNode:
+		return sq.match(n.left, i) && sq.match(n.right, i)
+	case orNode:
+		return sq.match(n.left, i) || sq.match(n.right, i)
+	case notNode:
+		return !sq.match(n.node, i)
+	case *condition:
+		return sq.matchCondition(n, i)
+	}
+	return false
+}
+
+func (sq *storeQuery) matchCondition(c *condition, i int) bool {
+	s := sq.store
+	switch c.field {
+	case fieldName:
+		return c.matchString(s.name(i))
+	case fieldEmail:
+		return c.matchString(s.email(i))
+	}
+
+	matched, ok := sq.browsers[c]
+	if !ok {
+		matched = make([]bool, len(s.browsers))
+		for id, browser := range s.browsers {
+			value := sq.browserValue(c, browser)
+			if c.op == opNe {
+				matched[id] = value == c.value
+			} else {
+				matched[id] = c.matchString(value)
+			}
+		}
+		sq.browsers[c] = matched
+	}
+
+	found := false
+	for _, id := range s.browserIDs[s.browserStart[i]:s.browserStart[i+1]] {
+		if matched[id] {
+			found = true
+			break
+		}
+	}
+	// != - ни один браузер не равен значению
+	return found != (c.op == opNe)
+}
+
+// browserValue - condition.browserValue, но разобранные браузеры берутся из
+// кеша хранилища: он общий для всех запросов, а у запроса свой, пустой
+func (sq *storeQuery) browserValue(c *condition, browser string) string {
+	if c.field == fieldBrowsers {
+		return browser
+	}
+	return c.field.agentValue(sq.store.agents.Parse(browser))
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 1000
+)
+
+// таймауты соединения: медленный клиент не держит горутину и сокет бесконечно
+const (
+	serverReadHeaderTimeout = 5 * time.Second
+	serverReadTimeout       = 10 * time.Second
+	serverWriteTimeout      = 30 * time.Second
+	serverIdleTimeout       = 2 * time.Minute
+)
+
+// SearchServer - HTTP-поиск по UserStore, ответы в JSON:
+//
+//	GET /search?q=browsers has "Android" and browsers has "MSIE"&offset=0&limit=20
+//	GET /search?has=Android&has=MSIE&op=or
+//	GET /search?q=...&mask_name=partial&mask_email=hash
+//
+// q - запрос на языке Query по полям browsers, name, email и разобранным из
+// browsers; has - подстроки браузеров, связанные op (and по умолчанию). Без q
+// и has - DefaultQuery. mask_name и mask_email - политики ParseMaskPolicy для
+// name и email в ответе, по умолчанию DefaultMasking.
+type SearchServer struct {
+	store *UserStore
+}
+
+func NewSearchServer(store *UserStore) *SearchServer {
+	return &SearchServer{store: store}
+}
+
+// ServeSearch загружает dataPath и отвечает на addr, пока не упадёт
+func ServeSearch(addr, dataPath string) error {
+	store, err := LoadUserStoreFile(dataPath)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewSearchServer(store),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+	return server.ListenAndServe()
+}
+
+type searchErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (srv *SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/search" {
+		writeErrorJSON(w, "not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeErrorJSON(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	src, err := searchQuery(params.Get("q"), params["has"], params.Get("op"))
+	if err != nil {
+		writeErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := intParam(params.Get("offset"), 0, 0, math.MaxInt32)
+	if err != nil {
+		writeErrorJSON(w, "offset: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(params.Get("limit"), defaultPageLimit, 1, maxPageLimit)
+	if err != nil {
+		writeErrorJSON(w, "limit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	masking := DefaultMasking
+	if masking.Name, err = maskParam(params.Get("mask_name"), masking.Name); err != nil {
+		writeErrorJSON(w, "mask_name: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if masking.Email, err = maskParam(params.Get("mask_email"), masking.Email); err != nil {
+		writeErrorJSON(w, "mask_email: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q, err := CompileQuery(src)
+	if err != nil {
+		writeErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := srv.store.Search(q, offset, limit)
+	if err != nil {
+		writeErrorJSON(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i, u := range page.Users {
+		page.Users[i] = masking.user(u)
+	}
+	writeJSON(w, page, http.StatusOK)
+}
+
+// searchQuery - текст запроса из параметров q или has и op
+func searchQuery(q string, has []string, op string) (string, error) {
+	if op == "" {
+		op = "and"
+	}
+	if op != "and" && op != "or" {
+		return "", fmt.Errorf(`op %q, expected "and" or "or"`, op)
+	}
+	switch {
+	case q != "" && len(has) > 0:
+		return "", errors.New("use either q or has")
+	case q != "":
+		return q, nil
+	case len(has) == 0:
+		return DefaultQuery, nil
+	}
+	parts := make([]string, len(has))
+	for i, substr := range has {
+		parts[i] = "browsers has " + strconv.Quote(substr)
+	}
+	return strings.Join(parts, " "+op+" "), nil
+}
+
+// intParam - число из параметра в [lo, hi]; пустой параметр - def
+func intParam(s string, def, lo, hi int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("%d is out of range [%d, %d]", n, lo, hi)
+	}
+	return n, nil
+}
+
+// maskParam - политика из параметра; пустой параметр - def
+func maskParam(s string, def MaskPolicy) (MaskPolicy, error) {
+	if s == "" {
+		return def, nil
+	}
+	return ParseMaskPolicy(s)
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+func writeErrorJSON(w http.ResponseWriter, reason string, status int) {
+	writeJSON(w, searchErrorResponse{Error: reason}, status)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"hw3/user"
+)
+
+var (
+	storeOnce sync.Once
+	store     *UserStore
+)
+
+func loadStore(t testing.TB) *UserStore {
+	storeOnce.Do(func() {
+		var err error
+		if store, err = LoadUserStoreFile(filePath); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return store
+}
+
+// getSearch - ответ сервера на /search с параметрами params
+func getSearch(t testing.TB, srv http.Handler, params url.Values, out interface{}) int {
+	req := httptest.NewRequest(http.MethodGet, "/search?"+params.Encode(), nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("%s: content type %q", params.Encode(), ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("%s: %v: %s", params.Encode(), err, rec.Body)
+	}
+	return rec.Code
+}
+
+func TestUserStore(t *testing.T) {
+	s := loadStore(t)
+	lines := readLines(t)
+	if s.Len() != len(lines) {
+		t.Fatalf("%d users, %d lines", s.Len(), len(lines))
+	}
+	var expected plainUser
+	var got user.Record
+	fileSize := 0
+	for i, line := range lines {
+		expected = plainUser{}
+		if err := json.Unmarshal(line, &expected); err != nil {
+			t.Fatal(err)
+		}
+		got = user.Record{Name: s.name(i), Email: s.email(i)}
+		for _, id := range s.browserIDs[s.browserStart[i]:s.browserStart[i+1]] {
+			got.Browsers = append(got.Browsers, s.browsers[id])
+		}
+		if got.Name != expected.Name || got.Email != expected.Email || !reflect.DeepEqual(got.Browsers, expected.Browsers) {
+			t.Fatalf("user %d: got %+v, expected %+v", i, got, expected)
+		}
+		fileSize += len(line) + 1
+	}
+	// браузеры повторяются, остальные поля не хранятся: в памяти втрое меньше, чем в файле
+	if size := s.size(); size*3 > fileSize || len(s.browsers) != 670 {
+		t.Errorf("store takes %d bytes of %d, %d unique browsers", size, fileSize, len(s.browsers))
+	}
+}
+
+// TestServerSearch - сервер находит тех же пользователей, что и Search
+func TestServerSearch(t *testing.T) {
+	srv := NewSearchServer(loadStore(t))
+	queries := []string{
+		``,
+		`browsers has "Opera" or browsers has "Safari"`,
+		`browsers has "Windows NT 6.1" and not browsers has "rv:11"`,
+		`browser = "IE" and os = "Windows" or email has ".edu"`,
+		`name has "John" and (browsers has "Linux" or device = "mobile")`,
+		`browsers = "nothing"`,
+		`not browsers has "Chrome" and os != "Windows" and browsers != "Opera/9.80 (Android; Opera Mini/7.5.33361/31.1543; U; en) Presto/2.8.119 Version/11.1010"`,
+	}
+	for _, src := range queries {
+		var page SearchPage
+		if code := getSearch(t, srv, url.Values{"q": {src}, "limit": {strconv.Itoa(maxPageLimit)}}, &page); code != http.StatusOK {
+			t.Fatalf("%s: status %d", src, code)
+		}
+		var q *Query
+		if src != "" {
+			q = MustCompileQuery(src)
+		}
+		expected := searchFile(t, filePath, q)
+		expected.Users = maskUsers(expected.Users, DefaultMasking)
+		if page.Total != len(expected.Users) || page.UniqueBrowsers != expected.UniqueBrowsers || !reflect.DeepEqual(page.Users, expected.Users) {
+			t.Errorf("%s: got %d users, %d unique browsers, expected %d, %d",
+				src, page.Total, page.UniqueBrowsers, len(expected.Users), expected.UniqueBrowsers)
+		}
+	}
+
+	// has и op - то же, что запрос
+	var byHas, byQuery SearchPage
+	getSearch(t, srv, url.Values{"has": {"Opera", `"Safari"`}, "op": {"or"}}, &byHas)
+	getSearch(t, srv, url.Values{"q": {`browsers has "Opera" or browsers has "\"Safari\""`}}, &byQuery)
+	if !reflect.DeepEqual(byHas, byQuery) {
+		t.Errorf("has: got %+v, expected %+v", byHas, byQuery)
+	}
+}
+
+func TestServerPagination(t *testing.T) {
+	srv := NewSearchServer(loadStore(t))
+	expected := maskUsers(searchFile(t, filePath, nil).Users, DefaultMasking)
+
+	var users []FoundUser
+	for offset := 0; ; offset += 7 {
+		var page SearchPage
+		getSearch(t, srv, url.Values{"offset": {strconv.Itoa(offset)}, "limit": {"7"}}, &page)
+		if page.Total != len(expected) || page.Offset != offset || page.Limit != 7 || page.UniqueBrowsers != 114 {
+			t.Fatalf("unexpected page %+v", page)
+		}
+		if len(page.Users) == 0 {
+			break
+		}
+		users = append(users, page.Users...)
+	}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("pages give %d users, expected %d", len(users), len(expected))
+	}
+
+	var page SearchPage
+	getSearch(t, srv, url.Values{}, &page)
+	if len(page.Users) != defaultPageLimit || page.Limit != defaultPageLimit || page.Query != DefaultQuery {
+		t.Errorf("default page: %d users, limit %d, query %q", len(page.Users), page.Limit, page.Query)
+	}
+}
+
+// maskUsers - users с name и email, замаскированными masking
+func maskUsers(users []FoundUser, masking Masking) []FoundUser {
+	masked := make([]FoundUser, len(users))
+	for i, u := range users {
+		masked[i] = masking.user(u)
+	}
+	return masked
+}
+
+func TestServerMasking(t *testing.T) {
+	srv := NewSearchServer(loadStore(t))
+	raw := searchFile(t, filePath, nil).Users[:defaultPageLimit]
+	for _, c := range []struct {
+		params  url.Values
+		masking Masking
+	}{
+		{url.Values{}, DefaultMasking},
+		{url.Values{"mask_email": {"none"}}, Masking{}},
+		{url.Values{"mask_name": {"redact"}, "mask_email": {"hash"}}, Masking{Name: MaskRedact, Email: MaskHash}},
+		{url.Values{"mask_name": {"partial"}}, Masking{Name: MaskPartial, Email: MaskAt}},
+	} {
+		var page SearchPage
+		if code := getSearch(t, srv, c.params, &page); code != http.StatusOK {
+			t.Fatalf("%s: status %d", c.params.Encode(), code)
+		}
+		if expected := maskUsers(raw, c.masking); !reflect.DeepEqual(page.Users, expected) {
+			t.Errorf("%s: got %+v, expected %+v", c.params.Encode(), page.Users[0], expected[0])
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := NewSearchServer(loadStore(t))
+	cases := map[string]url.Values{
+		"bad query":     {"q": {`browsers has`}},
+		"not in memory": {"q": {`country = "Kenya"`}},
+		"q and has":     {"q": {DefaultQuery}, "has": {"MSIE"}},
+		"bad op":        {"has": {"MSIE"}, "op": {"xor"}},
+		"zero limit":    {"limit": {"0"}},
+		"big limit":     {"limit": {strconv.Itoa(maxPageLimit + 1)}},
+		"bad limit":     {"limit": {"ten"}},
+		"bad offset":    {"offset": {"-1"}},
+		"bad mask":      {"mask_email": {"xor"}},
+	}
+	for name, params := range cases {
+		var resp searchErrorResponse
+		if code := getSearch(t, srv, params, &resp); code != http.StatusBadRequest || resp.Error == "" {
+			t.Errorf("%s: status %d, error %q", name, code, resp.Error)
+		}
+	}
+
+	for target, status := range map[string]int{
+		"POST /search": http.StatusMethodNotAllowed,
+		"GET /users":   http.StatusNotFound,
+	} {
+		parts := strings.Fields(target)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(parts[0], parts[1], nil))
+		if rec.Code != status {
+			t.Errorf("%s: status %d, expected %d", target, rec.Code, status)
+		}
+	}
+}
+
+// TestServerConcurrent - запросы из многих горутин делят кеш разобранных браузеров
+func TestServerConcurrent(t *testing.T) {
+	// своё хранилище, чтобы кеш был пустым и горутины заполняли его одновременно
+	fresh, err := LoadUserStoreFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := "/search?" + url.Values{"q": {`browser = "IE" and os = "Windows" or device = "tablet"`}}.Encode()
+	searchOn := func(srv http.Handler) string {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec.Body.String()
+	}
+	expected := searchOn(NewSearchServer(loadStore(t)))
+	srv := NewSearchServer(fresh)
+
+	wg := &sync.WaitGroup{}
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := searchOn(srv); got != expected {
+				t.Errorf("got %s, expected %s", got, expected)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkLoadUserStore(b *testing.B) {
+	var s *UserStore
+	for i := 0; i < b.N; i++ {
+		var err error
+		if s, err = LoadUserStoreFile(filePath); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(s.size()), "store-bytes")
+}
+
+// BenchmarkServerHandler - обработка запроса без сети
+func BenchmarkServerHandler(b *testing.B) {
+	srv := NewSearchServer(loadStore(b))
+	req := httptest.NewRequest(http.MethodGet, "/search?limit=100", nil)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+// BenchmarkServerLoad - нагрузка через httptest.Server с keep-alive: запросы
+// идут из GOMAXPROCS горутин, ns/op - время на запрос при такой параллельности
+func BenchmarkServerLoad(b *testing.B) {
+	ts := httptest.NewServer(NewSearchServer(loadStore(b)))
+	defer ts.Close()
+
+	queries := []string{
+		"/search?limit=100",
+		"/search?has=Opera&has=Safari&op=or&offset=100",
+		"/search?" + url.Values{"q": {`browser = "IE" and os = "Windows"`}}.Encode(),
+	}
+	client := ts.Client()
+	client.Transport.(*http.Transport).MaxIdleConnsPerHost = 64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			resp, err := client.Get(ts.URL + queries[i%len(queries)])
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				b.Errorf("status %d", resp.StatusCode)
+				return
+			}
+		}
+	})
+}
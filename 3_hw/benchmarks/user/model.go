@@ -5,3 +5,14 @@ type User struct {
 	Name     string   `json:"name"`
 	Email    string   `json:"email"`
 }
+
+// Record - все поля строки users.txt, для поиска по запросу
+type Record struct {
+	Browsers []string `json:"browsers"`
+	Company  string   `json:"company"`
+	Country  string   `json:"country"`
+	Email    string   `json:"email"`
+	Job      string   `json:"job"`
+	Name     string   `json:"name"`
+	Phone    string   `json:"phone"`
+}
@@ -0,0 +1,231 @@
+package useragent
+
+// Правила проверяются сверху вниз до первого совпадения, поэтому более конкретные
+// стоят выше: Edge и Opera притворяются Chrome, Chrome - Safari, почти все - Mozilla.
+
+var browserRules = []rule{
+	// боты, в том числе притворяющиеся мобильными браузерами
+	{match: "Googlebot", name: "Googlebot", version: []string{"Googlebot/", "Googlebot-Mobile/", "Googlebot-Image/", "Googlebot-Video/"}, device: Bot},
+	{match: "AdsBot-Google", name: "AdsBot-Google", device: Bot},
+	{match: "Mediapartners-Google", name: "Mediapartners-Google", device: Bot},
+	{match: "FeedFetcher-Google", name: "FeedFetcher-Google", device: Bot},
+	{match: "bingbot", name: "Bingbot", version: []string{"bingbot/"}, device: Bot},
+	{match: "msnbot", name: "Msnbot", version: []string{"msnbot/", "msnbot-media/"}, device: Bot},
+	{match: "Baiduspider", name: "Baiduspider", device: Bot},
+	{match: "Yahoo! Slurp", name: "Yahoo! Slurp", device: Bot},
+	{match: "Exabot", name: "Exabot", version: []string{"Exabot/"}, device: Bot},
+	{match: "facebookexternalhit", name: "Facebook", version: []string{"facebookexternalhit/"}, device: Bot},
+	{match: "Facebot", name: "Facebook", device: Bot},
+	{match: "Ask Jeeves", name: "Ask Jeeves", device: Bot},
+
+	{match: "Edge/", name: "Edge", version: []string{"Edge/"}},
+	{match: "OPR/", name: "Opera", version: []string{"OPR/"}},
+	{match: "Opera Mini", name: "Opera Mini", version: []string{"Opera Mini/"}},
+	{match: "Opera Mobi", name: "Opera Mobile", version: []string{"Version/", "Opera/"}},
+	// Opera 9.80+ пишет настоящую версию в Version/
+	{match: "Opera", name: "Opera", version: []string{"Version/", "Opera/", "Opera "}},
+	{match: "Vivaldi/", name: "Vivaldi", version: []string{"Vivaldi/"}},
+	{match: "Maxthon", name: "Maxthon", version: []string{"Maxthon/", "Maxthon "}},
+	{match: "Avant Browser", name: "Avant Browser", version: []string{"Avant Browser/"}},
+	{match: "UCBrowser/", name: "UC Browser", version: []string{"UCBrowser/"}},
+	{match: "UCWEB/", name: "UC Browser", version: []string{"UCWEB/"}},
+	{match: "UBrowser/", name: "UC Browser", version: []string{"UBrowser/"}},
+	{match: "SamsungBrowser/", name: "Samsung Internet", version: []string{"SamsungBrowser/"}},
+	{match: "Silk", name: "Silk", version: []string{"Silk/"}},
+	{match: "Puffin/", name: "Puffin", version: []string{"Puffin/"}},
+	{match: "Beamrise/", name: "Beamrise", version: []string{"Beamrise/"}},
+	{match: "CriOS/", name: "Chrome", version: []string{"CriOS/"}},
+	{match: "GSA/", name: "Google App", version: []string{"GSA/"}},
+	{match: "NokiaBrowser/", name: "Nokia Browser", version: []string{"NokiaBrowser/"}},
+	{match: "BrowserNG/", name: "Nokia Browser", version: []string{"BrowserNG/"}},
+	{match: "webOSBrowser/", name: "webOS Browser", version: []string{"webOSBrowser/"}},
+	{match: "wOSBrowser/", name: "webOS Browser", version: []string{"wOSBrowser/"}},
+	{match: "BOLT/", name: "Bolt", version: []string{"BOLT/"}},
+	{match: "Blazer/", name: "Blazer", version: []string{"Blazer/"}},
+	{match: "EudoraWeb", name: "EudoraWeb", version: []string{"EudoraWeb "}},
+	{match: "ReqwirelessWeb/", name: "ReqwirelessWeb", version: []string{"ReqwirelessWeb/"}},
+	{match: "NetFront", name: "NetFront", version: []string{"NetFront/"}},
+	{match: "UP.Browser/", name: "Openwave", version: []string{"UP.Browser/"}},
+	{match: "Obigo/", name: "Obigo", version: []string{"Obigo/"}},
+	{match: "POLARIS/", name: "Polaris", version: []string{"POLARIS/"}},
+	{match: "SEMC-Browser/", name: "SEMC Browser", version: []string{"SEMC-Browser/"}},
+
+	{match: "IEMobile", name: "IE Mobile", version: []string{"IEMobile/", "IEMobile "}},
+	{match: "MSIE", name: "IE", version: []string{"MSIE "}},
+	// IE 11 больше не пишет MSIE
+	{match: "Trident/7.0", and: "rv:", name: "IE", version: []string{"rv:"}},
+
+	{match: "SeaMonkey/", name: "SeaMonkey", version: []string{"SeaMonkey/"}},
+	{match: "Camino/", name: "Camino", version: []string{"Camino/"}},
+	{match: "Iceweasel/", name: "Iceweasel", version: []string{"Iceweasel/"}},
+	{match: "Fennec/", name: "Firefox Mobile", version: []string{"Fennec/"}},
+	{match: "Minefield/", name: "Firefox", version: []string{"Minefield/"}},
+	{match: "Phoenix/", name: "Firefox", version: []string{"Phoenix/"}},
+	{match: "shadowfox/", name: "Shadowfox", version: []string{"shadowfox/"}},
+	{match: "Swiftfox", name: "Swiftfox", version: []string{"Firefox/"}},
+	{match: "Galeon/", name: "Galeon", version: []string{"Galeon/"}},
+	{match: "Epiphany/", name: "Epiphany", version: []string{"Epiphany/"}},
+	{match: "Konqueror", name: "Konqueror", version: []string{"Konqueror/"}},
+	{match: "konqueror/", name: "Konqueror", version: []string{"konqueror/"}},
+	{match: "Midori/", name: "Midori", version: []string{"Midori/"}},
+	{match: "Arora/", name: "Arora", version: []string{"Arora/"}},
+	{match: "QupZilla/", name: "QupZilla", version: []string{"QupZilla/"}},
+	{match: "OmniWeb/", name: "OmniWeb", version: []string{"OmniWeb/v"}},
+	{match: "NetPositive/", name: "NetPositive", version: []string{"NetPositive/"}},
+	{match: "Dillo", name: "Dillo", version: []string{"Dillo "}},
+	{match: "ELinks", name: "ELinks", version: []string{"ELinks/", "ELinks ("}},
+	{match: "Links", name: "Links", version: []string{"Links/", "Links ("}},
+	{match: "Lynx/", name: "Lynx", version: []string{"Lynx/"}},
+	{match: "w3m/", name: "w3m", version: []string{"w3m/"}},
+	{match: "Wget/", name: "Wget", version: []string{"Wget/"}},
+	{match: "iTunes/", name: "iTunes", version: []string{"iTunes/"}},
+
+	{match: "Chromium/", name: "Chromium", version: []string{"Chromium/"}},
+	{match: "Chrome/", name: "Chrome", version: []string{"Chrome/"}},
+	{match: "Firefox", name: "Firefox", version: []string{"Firefox/"}},
+	{match: "Android", and: "Safari", name: "Android Browser", version: []string{"Version/"}},
+	{match: "Safari", name: "Safari", version: []string{"Version/"}},
+	{match: "Gecko", and: "rv:", name: "Mozilla", version: []string{"rv:"}},
+}
+
+var osRules = []rule{
+	{match: "Windows Phone", name: "Windows Phone", version: []string{"Windows Phone OS ", "Windows Phone "}},
+	{match: "Windows CE", name: "Windows CE"},
+	{match: "WindowsCE", name: "Windows CE", version: []string{"WindowsCE "}},
+	{match: "Windows NT", name: "Windows", version: []string{"Windows NT "}},
+	{match: "Windows XP", name: "Windows", version: []string{"Windows "}},
+	{match: "Windows 98", name: "Windows", version: []string{"Windows "}},
+	{match: "Win95", name: "Windows", version: []string{"Win"}},
+	{match: "WinNT4.0", name: "Windows", version: []string{"Win"}},
+	{match: "Microsoft Windows", name: "Windows"},
+	{match: "Windows;", name: "Windows"},
+
+	// iOS пишет "like Mac OS X", поэтому раньше Mac OS X
+	{match: "iPhone OS", name: "iOS", version: []string{"iPhone OS "}},
+	{match: "iPad", name: "iOS", version: []string{"CPU OS ", "iPad OS "}},
+	{match: "iPhone", name: "iOS", version: []string{"CPU OS "}},
+	{match: "Darwin/", name: "iOS"},
+
+	{match: "Android", name: "Android", version: []string{"Android "}},
+	{match: "BB10", name: "BlackBerry", version: []string{"Version/"}},
+	{match: "RIM Tablet OS", name: "BlackBerry Tablet OS", version: []string{"RIM Tablet OS "}},
+	{match: "BlackBerry", name: "BlackBerry"},
+	{match: "CrOS", name: "Chrome OS"},
+	{match: "Kindle", name: "Kindle", version: []string{"Kindle/"}},
+	{match: "Mac OS X", name: "Mac OS X", version: []string{"Mac OS X "}},
+	{match: "Macintosh", name: "Mac OS"},
+	{match: "Mac_PowerPC", name: "Mac OS"},
+
+	{match: "SymbianOS", name: "Symbian", version: []string{"SymbianOS/"}},
+	{match: "Symbian", name: "Symbian", version: []string{"Symbian/"}},
+	{match: "SymbOS", name: "Symbian"},
+	{match: "Series60", name: "Symbian"},
+	{match: "Series80", name: "Symbian"},
+	{match: "webOS", name: "webOS", version: []string{"webOS/"}},
+	{match: "hpwOS", name: "webOS", version: []string{"hpwOS/"}},
+	{match: "MeeGo", name: "MeeGo"},
+	{match: "Maemo", name: "Maemo"},
+	{match: "PalmOS", name: "Palm OS", version: []string{"PalmOS "}},
+	{match: "PalmSource", name: "Palm OS"},
+	{match: "PlayStation Portable", name: "PSP"},
+	{match: "PLAYSTATION 3", name: "PlayStation", version: []string{"PLAYSTATION "}},
+	{match: "Nintendo Wii", name: "Wii"},
+	{match: "Roku", name: "Roku"},
+
+	{match: "FreeBSD", name: "FreeBSD"},
+	{match: "NetBSD", name: "NetBSD"},
+	{match: "OpenBSD", name: "OpenBSD"},
+	{match: "SunOS", name: "Solaris"},
+	{match: "IRIX", name: "IRIX"},
+	{match: "BeOS", name: "BeOS"},
+	{match: "OS/2", name: "OS/2"},
+	{match: "Linux", name: "Linux"},
+	{match: "Ubuntu", name: "Linux"},
+	{match: "X11", name: "Linux"},
+	{match: "J2ME", name: "J2ME"},
+	{match: "MIDP", name: "J2ME"},
+}
+
+var windowsNT = map[string]string{
+	"10.0":  "10",
+	"6.3":   "8.1",
+	"6.2":   "8",
+	"6.1":   "7",
+	"6.0":   "Vista",
+	"5.2":   "XP",
+	"5.1":   "XP",
+	"5.0":   "2000",
+	"NT4.0": "NT 4.0",
+	"95":    "95",
+}
+
+// deviceRules - только для тех, кого не определил браузер (боты)
+var deviceRules = []rule{
+	{match: "PlayStation Portable", name: Console},
+	{match: "PLAYSTATION", name: Console},
+	{match: "Nintendo", name: Console},
+	{match: "Roku", name: TV},
+
+	{match: "iPad", name: Tablet},
+	{match: "Tablet", name: Tablet},
+	{match: "PlayBook", name: Tablet},
+	{match: "hp-tablet", name: Tablet},
+	{match: "Kindle", name: Tablet},
+	{match: "KFTT", name: Tablet},
+	{match: "Xoom", name: Tablet},
+	{match: "Nexus 7", name: Tablet},
+	{match: "Nexus 9", name: Tablet},
+	{match: "BNTV", name: Tablet},
+	{match: "GT-P", name: Tablet},
+	{match: "SM-T", name: Tablet},
+	{match: "nook", name: Tablet},
+
+	{match: "Mobile", name: Mobile},
+	{match: "Mobi", name: Mobile},
+	{match: "iPhone", name: Mobile},
+	{match: "iPod", name: Mobile},
+	{match: "Windows Phone", name: Mobile},
+	{match: "Windows CE", name: Mobile},
+	{match: "WindowsCE", name: Mobile},
+	{match: "BlackBerry", name: Mobile},
+	{match: "BB10", name: Mobile},
+	{match: "Symbian", name: Mobile},
+	{match: "SymbOS", name: Mobile},
+	{match: "Series60", name: Mobile},
+	{match: "Series80", name: Mobile},
+	{match: "MIDP", name: Mobile},
+	{match: "J2ME", name: Mobile},
+	{match: "Opera Mini", name: Mobile},
+	{match: "PalmOS", name: Mobile},
+	{match: "PalmSource", name: Mobile},
+	{match: "webOS", name: Mobile},
+	{match: "MeeGo", name: Mobile},
+	{match: "Maemo", name: Mobile},
+	{match: "DoCoMo", name: Mobile},
+	{match: "UP.Browser", name: Mobile},
+	{match: "NetFront", name: Mobile},
+	{match: "UCWEB", name: Mobile},
+	{match: "Nokia", name: Mobile},
+	{match: "SonyEricsson", name: Mobile},
+	{match: "PPC;", name: Mobile},
+	// Android без Mobile - планшет
+	{match: "Android", name: Tablet},
+}
+
+// Desktop определяется по ОС, если ни одно правило устройства не сработало
+var desktopOS = map[string]bool{
+	"Windows":   true,
+	"Mac OS X":  true,
+	"Mac OS":    true,
+	"Linux":     true,
+	"Chrome OS": true,
+	"FreeBSD":   true,
+	"NetBSD":    true,
+	"OpenBSD":   true,
+	"Solaris":   true,
+	"IRIX":      true,
+	"BeOS":      true,
+	"OS/2":      true,
+}
+
+var botWords = []string{"bot", "spider", "crawler", "slurp", "validator", "feedfetcher", "bloglines"}
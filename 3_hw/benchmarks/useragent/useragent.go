@@ -0,0 +1,160 @@
+// Package useragent разбирает строки User-Agent из users.txt на семейство и версию
+// браузера, ОС и тип устройства по таблицам правил из rules.go.
+package useragent
+
+import (
+	"strings"
+	"sync"
+)
+
+type Agent struct {
+	Browser        string // Chrome, Firefox, IE, Safari, Opera, ...; Other - не распознан
+	BrowserVersion string
+	OS             string // Windows, Mac OS X, iOS, Android, Linux, ...; Other - не распознана
+	OSVersion      string
+	Device         string // desktop, mobile, tablet, console, tv, bot, other
+}
+
+const (
+	Other = "Other"
+
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Console = "console"
+	TV      = "tv"
+	Bot     = "bot"
+	Unknown = "other"
+)
+
+// rule срабатывает, если в строке есть match (и and, если задан)
+type rule struct {
+	match   string
+	and     string
+	name    string
+	version []string // после какой подстроки искать версию, первая найденная побеждает
+	device  string   // для браузеров: тип устройства, который определяется самим браузером (боты)
+}
+
+func (r *rule) matches(ua string) bool {
+	return strings.Contains(ua, r.match) && (r.and == "" || strings.Contains(ua, r.and))
+}
+
+func (r *rule) versionIn(ua string) string {
+	for _, prefix := range r.version {
+		if i := strings.Index(ua, prefix); i >= 0 {
+			if v := readVersion(ua[i+len(prefix):]); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// readVersion - всё до первого разделителя
+func readVersion(s string) string {
+	end := strings.IndexAny(s, " ;)(/,[]")
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end]
+}
+
+func Parse(ua string) Agent {
+	var agent Agent
+
+	browser := firstMatch(browserRules, ua)
+	if browser != nil {
+		agent.Browser, agent.BrowserVersion = browser.name, browser.versionIn(ua)
+	} else {
+		agent.Browser, agent.BrowserVersion = product(ua)
+	}
+
+	if os := firstMatch(osRules, ua); os != nil {
+		agent.OS, agent.OSVersion = os.name, os.versionIn(ua)
+		if os.name == "Windows" || os.name == "Windows Phone" {
+			agent.OSVersion = windowsVersion(agent.OSVersion)
+		} else {
+			// Mac OS X 10_10_1, iPhone OS 7_1_2
+			agent.OSVersion = strings.Replace(agent.OSVersion, "_", ".", -1)
+		}
+	} else {
+		agent.OS = Other
+	}
+
+	switch {
+	case browser != nil && browser.device != "":
+		agent.Device = browser.device
+	case isBot(ua):
+		agent.Device = Bot
+	default:
+		if device := firstMatch(deviceRules, ua); device != nil {
+			agent.Device = device.name
+		} else if desktopOS[agent.OS] {
+			agent.Device = Desktop
+		} else {
+			agent.Device = Unknown
+		}
+	}
+	return agent
+}
+
+func firstMatch(rules []rule, ua string) *rule {
+	for i := range rules {
+		if rules[i].matches(ua) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// product - запасной вариант для неизвестных агентов: первый токен вида Name/1.0
+func product(ua string) (string, string) {
+	slash := strings.IndexByte(ua, '/')
+	if slash <= 0 || strings.ContainsAny(ua[:slash], "(;") {
+		return Other, ""
+	}
+	return ua[:slash], readVersion(ua[slash+1:])
+}
+
+func windowsVersion(nt string) string {
+	if v, ok := windowsNT[nt]; ok {
+		return v
+	}
+	return nt
+}
+
+func isBot(ua string) bool {
+	lower := strings.ToLower(ua)
+	for _, word := range botWords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cache - Parse с запоминанием: в users.txt агентов сотни, а строк с ними тысячи
+type Cache struct {
+	mu     sync.RWMutex
+	agents map[string]Agent
+}
+
+func NewCache() *Cache {
+	return &Cache{agents: make(map[string]Agent)}
+}
+
+func (c *Cache) Parse(ua string) Agent {
+	c.mu.RLock()
+	agent, ok := c.agents[ua]
+	c.mu.RUnlock()
+	if ok {
+		return agent
+	}
+
+	agent = Parse(ua)
+	c.mu.Lock()
+	c.agents[ua] = agent
+	c.mu.Unlock()
+	return agent
+}
@@ -0,0 +1,128 @@
+package useragent
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// go test ./useragent -update
+var update = flag.Bool("update", false, "rewrite testdata/agents.golden")
+
+const (
+	usersPath  = "../data/users.txt"
+	goldenPath = "testdata/agents.golden"
+)
+
+// distinctAgents - все различные строки browsers из users.txt в порядке появления
+func distinctAgents(t *testing.T) []string {
+	file, err := os.Open(usersPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var agents []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var u struct {
+			Browsers []string `json:"browsers"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &u); err != nil {
+			t.Fatal(err)
+		}
+		for _, ua := range u.Browsers {
+			if !seen[ua] {
+				seen[ua] = true
+				agents = append(agents, ua)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return agents
+}
+
+func goldenLine(ua string, a Agent) string {
+	return strings.Join([]string{ua, a.Browser, a.BrowserVersion, a.OS, a.OSVersion, a.Device}, "\t")
+}
+
+func TestGolden(t *testing.T) {
+	agents := distinctAgents(t)
+
+	if *update {
+		var b strings.Builder
+		for _, ua := range agents {
+			b.WriteString(goldenLine(ua, Parse(ua)))
+			b.WriteByte('\n')
+		}
+		if err := ioutil.WriteFile(goldenPath, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(golden) != len(agents) {
+		t.Fatalf("golden has %d agents, users.txt has %d, run with -update", len(golden), len(agents))
+	}
+	for i, ua := range agents {
+		if got := goldenLine(ua, Parse(ua)); got != golden[i] {
+			t.Errorf("line %d:\ngot      %q\nexpected %q", i+1, got, golden[i])
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected Agent
+	}{
+		// IE 11 без MSIE, на котором ошибалась проверка подстроки
+		{"Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			Agent{"IE", "11.0", "Windows", "7", Desktop}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/42.0.2311.135 Safari/537.36 Edge/12.246",
+			Agent{"Edge", "12.246", "Windows", "10", Desktop}},
+		{"Mozilla/4.0 (compatible; MSIE 6.0; Windows NT 5.1; en) Opera 8.50",
+			Agent{"Opera", "8.50", "Windows", "XP", Desktop}},
+		{"Opera/9.80 (Windows NT 6.0) Presto/2.12.388 Version/12.14",
+			Agent{"Opera", "12.14", "Windows", "Vista", Desktop}},
+		{"Mozilla/5.0 (iPad; CPU OS 7_0_4 like Mac OS X) AppleWebKit/537.51.1 (KHTML, like Gecko) Version/7.0 Mobile/11B554a Safari/9537.53",
+			Agent{"Safari", "7.0", "iOS", "7.0.4", Tablet}},
+		{"Mozilla/5.0 (Linux; U; Android 4.0.3; ko-kr; LG-L160L Build/IML74K) AppleWebkit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30",
+			Agent{"Android Browser", "4.0", "Android", "4.0.3", Mobile}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Agent{"Googlebot", "2.1", Other, "", Bot}},
+		{"", Agent{Other, "", Other, "", Unknown}},
+	}
+	for _, c := range cases {
+		if got := Parse(c.ua); got != c.expected {
+			t.Errorf("%q: got %+v, expected %+v", c.ua, got, c.expected)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache()
+	for _, ua := range distinctAgents(t) {
+		if c.Parse(ua) != Parse(ua) || c.Parse(ua) != Parse(ua) {
+			t.Fatalf("%q: cached agent differs", ua)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	ua := "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko"
+	for i := 0; i < b.N; i++ {
+		Parse(ua)
+	}
+}